@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Status int
@@ -51,6 +52,8 @@ func (s Status) String() string {
 }
 
 type Action struct {
+	Time         time.Time // engine time
+	Seq          uint64    // numbers the actions of a market without gaps
 	Type         Status
 	OrderId      uint32
 	BuyerOrderId uint32
@@ -180,24 +183,48 @@ func NewBuy(id, price, amount uint32) *Order {
 type Market struct {
 	orders    map[uint32]*Order
 	actionsCh chan<- *Action
+	clock     func() time.Time
 	prices    []*heap
+	seq       uint64
 	sales     uint32
 	offers    uint32
 }
 
-func NewMarket(maximumPrice uint32, actionsCh chan<- *Action) *Market {
+// Option configures a Market
+type Option func(*Market)
+
+// WithClock sets the clock stamping actions (UTC wall clock by default)
+func WithClock(clock func() time.Time) Option {
+	return func(m *Market) {
+		m.clock = clock
+	}
+}
+
+func NewMarket(maximumPrice uint32, actionsCh chan<- *Action, options ...Option) *Market {
 	result := Market{
 		sales:     maximumPrice,
 		actionsCh: actionsCh,
+		clock:     func() time.Time { return time.Now().UTC() },
 		orders:    make(map[uint32]*Order),
 	}
 	result.prices = make([]*heap, maximumPrice)
 	for i := int(maximumPrice) - 1; i >= 0; i-- {
 		result.prices[uint32(i)] = &heap{}
 	}
+	for _, option := range options {
+		option(&result)
+	}
 	return &result
 }
 
+// send sequences and stamps an action, then sends it
+func (b *Market) send(action *Action) {
+	b.seq++
+	action.Seq = b.seq
+	action.Time = b.clock()
+	b.actionsCh <- action
+}
+
 func (b *Market) TakeOrder(order *Order) error {
 	if order.Volume <= 0 {
 		return errors.New("volume cannot be less or equal to zero")
@@ -205,10 +232,10 @@ func (b *Market) TakeOrder(order *Order) error {
 
 	// attempt to fill immediately
 	if order.IsBuy {
-		b.actionsCh <- NewBuyAction(order)
+		b.send(NewBuyAction(order))
 		b.Buy(order)
 	} else {
-		b.actionsCh <- NewSellAction(order)
+		b.send(NewSellAction(order))
 		b.Sell(order)
 	}
 
@@ -260,7 +287,7 @@ func (b *Market) Sell(order *Order) {
 
 func (b *Market) fill(order, fromOrder *Order) {
 	if fromOrder.Volume >= order.Volume {
-		b.actionsCh <- NewFilledAction(order, fromOrder)
+		b.send(NewFilledAction(order, fromOrder))
 		fromOrder.Volume -= order.Volume
 		order.Volume = 0
 		order.Status = FILLED
@@ -269,7 +296,7 @@ func (b *Market) fill(order, fromOrder *Order) {
 
 	// partial fill
 	if fromOrder.Volume > 0 {
-		b.actionsCh <- NewPartialFilledAction(order, fromOrder)
+		b.send(NewPartialFilledAction(order, fromOrder))
 		order.Volume -= fromOrder.Volume
 		order.Status = PARTIAL
 		fromOrder.Volume = 0
@@ -277,7 +304,7 @@ func (b *Market) fill(order, fromOrder *Order) {
 }
 
 func (b *Market) Cancel(orderID uint32) {
-	b.actionsCh <- NewCancelAction(orderID)
+	b.send(NewCancelAction(orderID))
 	if o, ok := b.orders[orderID]; ok {
 		// If this is the last order at a particular price point we need to update the bid / ask!
 		o.Volume = 0
@@ -285,9 +312,9 @@ func (b *Market) Cancel(orderID uint32) {
 		// TODO : check if has already a match and cancel that as well
 		delete(b.orders, orderID)
 	}
-	b.actionsCh <- NewCancelledAction(orderID)
+	b.send(NewCancelledAction(orderID))
 }
 
 func (b *Market) Finish() {
-	b.actionsCh <- NewDoneAction()
+	b.send(NewDoneAction())
 }
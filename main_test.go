@@ -79,7 +79,8 @@ func performanceTest(howMany uint32, meanPrice, standardPrice float64, maxAmount
 
 func TestBookKeeping(t *testing.T) {
 	actions := make(chan *Action)
-	book := NewMarket(MaxPrice, actions)
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	book := NewMarket(MaxPrice, actions, WithClock(func() time.Time { return engineTime }))
 	ctx, cancel := context.WithCancel(context.Background())
 	got := make([]*Action, 0)
 	go func() {
@@ -228,6 +229,12 @@ func TestBookKeeping(t *testing.T) {
 		},
 	}
 
+	// every action is stamped by the engine clock and numbered without gaps
+	for i, action := range expected {
+		action.Seq = uint64(i + 1)
+		action.Time = engineTime
+	}
+
 	if !reflect.DeepEqual(got, expected) {
 		for i := range expected {
 			if !reflect.DeepEqual(got[i], expected[i]) {
@@ -281,3 +288,95 @@ func TestActionListener(t *testing.T) {
 
 	<-ctx.Done()
 }
+
+// collectActions gathers the actions of a market until it is done
+func collectActions(actions <-chan *Action) <-chan []*Action {
+	result := make(chan []*Action)
+	go func() {
+		var got []*Action
+		for action := range actions {
+			got = append(got, action)
+			if action.Type == DONE {
+				result <- got
+				return
+			}
+		}
+	}()
+	return result
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	clock := WithClock(func() time.Time { return engineTime })
+
+	actions := make(chan *Action)
+	collected := collectActions(actions)
+	book := NewMarket(MaxPrice, actions, clock)
+	for _, order := range []*Order{NewSell(1, 50, 50), NewSell(2, 45, 25), NewSell(3, 45, 25), NewBuy(4, 55, 30), NewBuy(5, 20, 10), NewBuy(6, 20, 5)} {
+		if err := book.TakeOrder(order); err != nil {
+			t.Fatalf("error : %#v", err)
+		}
+	}
+	book.Cancel(5)
+
+	snapshot := book.Snapshot()
+
+	data, err := snapshot.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Snapshot
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*snapshot, decoded) {
+		t.Fatal("invalid decoded snapshot")
+	}
+
+	data[len(data)/2] ^= 0xff
+	if err := decoded.UnmarshalBinary(data); err == nil {
+		t.Fatal("corrupted snapshot should be detected")
+	}
+
+	text, err := snapshot.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ParseSnapshotJSON(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snapshot, fromJSON) {
+		t.Fatal("invalid JSON snapshot")
+	}
+
+	restoredActions := make(chan *Action)
+	restoredCollected := collectActions(restoredActions)
+	restored, err := Restore(fromJSON, restoredActions, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both books go on the same way
+	for _, market := range []*Market{book, restored} {
+		for _, order := range []*Order{NewSell(7, 20, 40), NewBuy(8, 48, 30)} {
+			if err := market.TakeOrder(order); err != nil {
+				t.Fatalf("error : %#v", err)
+			}
+		}
+		market.Cancel(6)
+		market.Finish()
+	}
+
+	got, restoredGot := <-collected, <-restoredCollected
+	if len(restoredGot) < 2 || len(got) < len(restoredGot) {
+		t.Fatal("invalid actions count", len(got), len(restoredGot))
+	}
+
+	expected := got[len(got)-len(restoredGot):]
+	for i := range expected {
+		if !reflect.DeepEqual(expected[i], restoredGot[i]) {
+			t.Error("\n\nExpected at index ", i, ":\n\n", expected[i], "\n\nGot:\n\n", restoredGot[i], "\n\n")
+		}
+	}
+}
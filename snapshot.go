@@ -0,0 +1,247 @@
+package matchengine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"sort"
+)
+
+// snapshotVersion is the version of the snapshot encodings, binary and JSON
+const snapshotVersion = 1
+
+var (
+	snapshotMagic = []byte("MEV1")
+	crcTable      = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type SnapshotOrder struct {
+	Id     uint32
+	Price  uint32
+	Volume uint32
+	IsBuy  bool
+	Status Status
+	Listed bool // the order can be cancelled by id
+}
+
+// SnapshotLevel holds the queued orders of a price, head first
+type SnapshotLevel struct {
+	Price  uint32
+	Orders []SnapshotOrder
+}
+
+// Snapshot is the full state of a Market : queued orders in their position, the best price cursors and the action
+// sequence. Detached are the orders which can still be cancelled by id, but are not queued anymore.
+type Snapshot struct {
+	MaximumPrice uint32
+	Seq          uint64
+	Sales        uint32
+	Offers       uint32
+	Levels       []SnapshotLevel
+	Detached     []SnapshotOrder
+}
+
+func snapshotOrder(order *Order, listed bool) SnapshotOrder {
+	return SnapshotOrder{Id: order.Id, Price: order.Price, Volume: order.Volume, IsBuy: order.IsBuy, Status: order.Status, Listed: listed}
+}
+
+// Snapshot captures the state of the market. It must not run while orders are taken.
+func (b *Market) Snapshot() *Snapshot {
+	result := &Snapshot{MaximumPrice: uint32(len(b.prices)), Seq: b.seq, Sales: b.sales, Offers: b.offers}
+
+	queued := map[*Order]bool{}
+	for price, prices := range b.prices {
+		if prices.head == nil {
+			continue
+		}
+
+		level := SnapshotLevel{Price: uint32(price)}
+		for order := prices.head; order != nil; order = order.next {
+			queued[order] = true
+			level.Orders = append(level.Orders, snapshotOrder(order, b.orders[order.Id] == order))
+		}
+		result.Levels = append(result.Levels, level)
+	}
+
+	for _, order := range b.orders {
+		if !queued[order] {
+			result.Detached = append(result.Detached, snapshotOrder(order, true))
+		}
+	}
+	sort.Slice(result.Detached, func(i, j int) bool { return result.Detached[i].Id < result.Detached[j].Id })
+
+	return result
+}
+
+// Restore rebuilds a market from a snapshot, so matching continues as if it never stopped
+func Restore(snapshot *Snapshot, actionsCh chan<- *Action, options ...Option) (*Market, error) {
+	if snapshot.Sales > snapshot.MaximumPrice || snapshot.Offers > snapshot.MaximumPrice {
+		return nil, errors.New("invalid snapshot prices")
+	}
+
+	result := NewMarket(snapshot.MaximumPrice, actionsCh, options...)
+	result.seq = snapshot.Seq
+	result.sales = snapshot.Sales
+	result.offers = snapshot.Offers
+
+	restore := func(order SnapshotOrder) *Order {
+		restored := &Order{Id: order.Id, Price: order.Price, Volume: order.Volume, IsBuy: order.IsBuy, Status: order.Status}
+		if order.Listed {
+			result.orders[order.Id] = restored
+		}
+		return restored
+	}
+
+	for _, level := range snapshot.Levels {
+		if level.Price >= snapshot.MaximumPrice {
+			return nil, errors.New("invalid snapshot prices")
+		}
+
+		for _, order := range level.Orders {
+			result.prices[level.Price].Insert(restore(order))
+		}
+	}
+
+	for _, order := range snapshot.Detached {
+		restore(order)
+	}
+
+	return result, nil
+}
+
+// MarshalBinary encodes the snapshot as its magic, version, content and CRC-32C checksum
+func (s *Snapshot) MarshalBinary() ([]byte, error) {
+	buf := append([]byte(nil), snapshotMagic...)
+	buf = binary.BigEndian.AppendUint16(buf, snapshotVersion)
+	buf = binary.BigEndian.AppendUint32(buf, s.MaximumPrice)
+	buf = binary.BigEndian.AppendUint64(buf, s.Seq)
+	buf = binary.BigEndian.AppendUint32(buf, s.Sales)
+	buf = binary.BigEndian.AppendUint32(buf, s.Offers)
+
+	appendOrders := func(orders []SnapshotOrder) {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(orders)))
+		for _, order := range orders {
+			buf = binary.BigEndian.AppendUint32(buf, order.Id)
+			buf = binary.BigEndian.AppendUint32(buf, order.Price)
+			buf = binary.BigEndian.AppendUint32(buf, order.Volume)
+			buf = append(buf, boolByte(order.IsBuy), byte(order.Status), boolByte(order.Listed))
+		}
+	}
+
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s.Levels)))
+	for _, level := range s.Levels {
+		buf = binary.BigEndian.AppendUint32(buf, level.Price)
+		appendOrders(level.Orders)
+	}
+	appendOrders(s.Detached)
+
+	return binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf, crcTable)), nil
+}
+
+func boolByte(value bool) byte {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// UnmarshalBinary decodes a snapshot written by MarshalBinary, checking its version and checksum
+func (s *Snapshot) UnmarshalBinary(data []byte) error {
+	header := len(snapshotMagic) + 2
+	if len(data) < header+4 || !bytes.Equal(data[:len(snapshotMagic)], snapshotMagic) {
+		return errors.New("not a market snapshot")
+	}
+
+	if version := binary.BigEndian.Uint16(data[len(snapshotMagic):]); version != snapshotVersion {
+		return errors.New("unsupported snapshot version")
+	}
+
+	content := data[:len(data)-4]
+	if crc32.Checksum(content, crcTable) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return errors.New("snapshot checksum mismatch")
+	}
+
+	buf := content[header:]
+	corrupted := false
+	read := func(size int) []byte {
+		if corrupted || len(buf) < size {
+			corrupted = true
+			return make([]byte, size)
+		}
+		result := buf[:size]
+		buf = buf[size:]
+		return result
+	}
+	readUint32 := func() uint32 { return binary.BigEndian.Uint32(read(4)) }
+
+	readOrders := func() []SnapshotOrder {
+		var result []SnapshotOrder
+		for i, count := uint32(0), readUint32(); i < count && !corrupted; i++ {
+			order := SnapshotOrder{Id: readUint32(), Price: readUint32(), Volume: readUint32()}
+			flags := read(3)
+			order.IsBuy, order.Status, order.Listed = flags[0] == 1, Status(flags[1]), flags[2] == 1
+			result = append(result, order)
+		}
+		return result
+	}
+
+	result := Snapshot{MaximumPrice: readUint32(), Seq: binary.BigEndian.Uint64(read(8)), Sales: readUint32(), Offers: readUint32()}
+	for i, count := uint32(0), readUint32(); i < count && !corrupted; i++ {
+		result.Levels = append(result.Levels, SnapshotLevel{Price: readUint32(), Orders: readOrders()})
+	}
+	result.Detached = readOrders()
+
+	if corrupted || len(buf) > 0 {
+		return errors.New("corrupted snapshot")
+	}
+
+	*s = result
+	return nil
+}
+
+// snapshotJSON is the JSON debug form of a snapshot. Checksum is the CRC-32C of the market, as written.
+type snapshotJSON struct {
+	Version  int             `json:"version"`
+	Checksum uint32          `json:"checksum"`
+	Market   json.RawMessage `json:"market"`
+}
+
+// JSON encodes the snapshot in the readable debug format, versioned and checksummed like the binary one
+func (s *Snapshot) JSON() ([]byte, error) {
+	market, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(snapshotJSON{Version: snapshotVersion, Checksum: crc32.Checksum(market, crcTable), Market: market}, "", "  ")
+}
+
+// ParseSnapshotJSON decodes a snapshot written by JSON, checking its version and checksum
+func ParseSnapshotJSON(data []byte) (*Snapshot, error) {
+	var file snapshotJSON
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	if file.Version != snapshotVersion {
+		return nil, errors.New("unsupported snapshot version")
+	}
+
+	var market bytes.Buffer
+	if err := json.Compact(&market, file.Market); err != nil {
+		return nil, err
+	}
+
+	if crc32.Checksum(market.Bytes(), crcTable) != file.Checksum {
+		return nil, errors.New("snapshot checksum mismatch")
+	}
+
+	result := &Snapshot{}
+	if err := json.Unmarshal(market.Bytes(), result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
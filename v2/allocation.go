@@ -0,0 +1,166 @@
+package market
+
+import (
+	"sort"
+)
+
+// Allocator shares an incoming volume among the orders resting in a price level.
+// Orders are given in time priority and the result holds the volume allocated to each of them. Implementations must
+// be deterministic, so that replaying the same commands produces the same fills.
+type Allocator interface {
+	Allocate(orders []*Order, volume Decimal) []Decimal
+}
+
+// Residue tells who gets the volume left after pro-rata shares were rounded down
+type Residue int
+
+const (
+	ResidueFIFO    Residue = iota // in time priority
+	ResidueLargest                // largest orders first, time priority between equals
+)
+
+// FIFO fills orders strictly in time priority
+type FIFO struct{}
+
+func (FIFO) Allocate(orders []*Order, volume Decimal) []Decimal {
+	result := make([]Decimal, len(orders))
+	for i, order := range orders {
+		result[i] = decimalMin(volume, order.Volume)
+		volume = volume.Sub(result[i])
+	}
+	return result
+}
+
+// ProRata shares volume proportionally to the resting size of each order.
+// Shares are rounded down to Lot (one unit when zero) and shares smaller than MinAllocation are dropped. What is left
+// after rounding is handed one lot at a time following the Residue rule, only to orders it brings to MinAllocation.
+type ProRata struct {
+	Lot           Decimal
+	MinAllocation Decimal
+	Residue       Residue
+}
+
+func (p ProRata) Allocate(orders []*Order, volume Decimal) []Decimal {
+	sizes := make([]Decimal, len(orders))
+	for i, order := range orders {
+		sizes[i] = order.Volume
+	}
+
+	lot := p.Lot
+	if lot.Sign() <= 0 {
+		lot = NewDecimalValue(1)
+	}
+
+	return proRata(volume, sizes, lot, p.MinAllocation, p.Residue == ResidueLargest)
+}
+
+// Hybrid gives the order at the top of the level a TopShare (0 to 1) of the incoming volume first, then shares the
+// rest pro-rata among all orders, top one included.
+type Hybrid struct {
+	TopShare Decimal
+	ProRata  ProRata
+}
+
+func (h Hybrid) Allocate(orders []*Order, volume Decimal) []Decimal {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	top := decimalMin(orders[0].Volume, volume.Mul(h.TopShare))
+	if lot := h.ProRata.Lot; lot.Sign() > 0 {
+		top = top.Div(lot).Floor().Mul(lot)
+	}
+
+	rest := make([]*Order, len(orders))
+	copy(rest, orders)
+	head := *orders[0]
+	head.Volume = head.Volume.Sub(top)
+	rest[0] = &head
+
+	result := h.ProRata.Allocate(rest, volume.Sub(top))
+	result[0] = result[0].Add(top)
+	return result
+}
+
+// proRata splits volume proportionally to sizes, in multiples of lot, dropping shares below minimum. The residue left
+// by rounding down is given one lot at a time in the given order, or to the biggest sizes first, to the orders it
+// brings to the minimum. Whatever is smaller than a lot goes to the first of them, and so does what only orders below
+// the minimum have room for, so that the whole volume is shared.
+func proRata(volume Decimal, sizes []Decimal, lot, minimum Decimal, largestFirst bool) []Decimal {
+	result := make([]Decimal, len(sizes))
+	total := NewZeroDecimal()
+	for i, size := range sizes {
+		total = total.Add(size)
+		result[i] = NewZeroDecimal()
+	}
+
+	if total.Sign() <= 0 {
+		return result
+	}
+
+	if volume.GreaterThanOrEqual(total) {
+		copy(result, sizes)
+		return result
+	}
+
+	left := volume
+	for i, size := range sizes {
+		share := decimalMin(size, volume.Mul(size).Div(total.Mul(lot)).Floor().Mul(lot))
+		if share.LessThan(minimum) {
+			continue
+		}
+		result[i] = share
+		left = left.Sub(share)
+	}
+
+	ranking := make([]int, len(sizes))
+	for i := range ranking {
+		ranking[i] = i
+	}
+	if largestFirst {
+		sort.SliceStable(ranking, func(i, j int) bool { return sizes[ranking[i]].GreaterThan(sizes[ranking[j]]) })
+	}
+
+	for left.GreaterThanOrEqual(lot) {
+		given := false
+		for _, i := range ranking {
+			if left.LessThan(lot) {
+				break
+			}
+
+			if sizes[i].Sub(result[i]).GreaterThanOrEqual(lot) && result[i].Add(lot).GreaterThanOrEqual(minimum) {
+				result[i] = result[i].Add(lot)
+				left = left.Sub(lot)
+				given = true
+			}
+		}
+
+		if !given {
+			break
+		}
+	}
+
+	for _, reaching := range []bool{true, false} {
+		for _, i := range ranking {
+			if left.Sign() <= 0 {
+				break
+			}
+
+			room := decimalMin(left, sizes[i].Sub(result[i]))
+			if reaching && result[i].Add(room).LessThan(minimum) {
+				continue
+			}
+			result[i] = result[i].Add(room)
+			left = left.Sub(room)
+		}
+	}
+
+	return result
+}
+
+func decimalMin(a, b Decimal) Decimal {
+	if a.LessThan(b) {
+		return a
+	}
+	return b
+}
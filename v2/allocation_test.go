@@ -0,0 +1,75 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func restingOrders(volumes ...int64) []*Order {
+	result := make([]*Order, len(volumes))
+	for i, volume := range volumes {
+		result[i] = NewSell("", NewDecimalValue(volume), NewDecimalValue(100), time.Time{})
+	}
+	return result
+}
+
+func checkAllocation(t *testing.T, name string, allocated []Decimal, expected ...int64) {
+	t.Helper()
+	if len(allocated) != len(expected) {
+		t.Fatal(name, "invalid allocations count", allocated)
+	}
+	for i := range expected {
+		if !allocated[i].Equal(NewDecimalValue(expected[i])) {
+			t.Fatal(name, "invalid allocation", allocated)
+		}
+	}
+}
+
+func TestAllocators(t *testing.T) {
+	orders := restingOrders(10, 5, 5)
+
+	checkAllocation(t, "fifo", FIFO{}.Allocate(orders, NewDecimalValue(12)), 10, 2, 0)
+	checkAllocation(t, "pro-rata", ProRata{}.Allocate(orders, NewDecimalValue(10)), 6, 2, 2)
+	checkAllocation(t, "pro-rata all", ProRata{}.Allocate(orders, NewDecimalValue(30)), 10, 5, 5)
+	checkAllocation(t, "pro-rata largest", ProRata{Residue: ResidueLargest}.Allocate(restingOrders(5, 10, 5), NewDecimalValue(10)), 2, 6, 2)
+	// 9 pcs : shares 4.5, 2.25, 2.25 are rounded to 4, 2, 2 and the 2 pcs minimum drops nothing
+	checkAllocation(t, "pro-rata fifo", ProRata{MinAllocation: NewDecimalValue(2)}.Allocate(orders, NewDecimalValue(9)), 5, 2, 2)
+	// 5 pcs : shares 2.5, 1.25, 1.25 are rounded to 2, 1, 1 and the minimum drops the last two, so does the residue
+	checkAllocation(t, "pro-rata minimum", ProRata{MinAllocation: NewDecimalValue(2)}.Allocate(orders, NewDecimalValue(5)), 5, 0, 0)
+	// 3 pcs : every share of 1 is below the minimum, the first order takes the whole volume
+	checkAllocation(t, "pro-rata all dropped", ProRata{MinAllocation: NewDecimalValue(2)}.Allocate(restingOrders(100, 100, 100), NewDecimalValue(3)), 3, 0, 0)
+	// 10 pcs : top order takes 4, the remaining 6 are shared among 6, 5, 5
+	checkAllocation(t, "hybrid", Hybrid{TopShare: NewDecimalValue(4).Div(NewDecimalValue(10))}.Allocate(orders, NewDecimalValue(10)), 7, 2, 1)
+}
+
+func TestMarketAllocator(t *testing.T) {
+	market := NewMarket(WithAllocator(ProRata{}))
+	for _, orderID := range []string{"sell-1", "sell-2", "sell-3"} {
+		volume := NewDecimalValue(5)
+		if orderID == "sell-1" {
+			volume = NewDecimalValue(10)
+		}
+		if _, _, _, err := market.ProcessSellOrder(orderID, volume, NewDecimalValue(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(10), NewDecimalValue(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(done) != 1 || done[0].ID != "buy-1" {
+		t.Fatal("only the incoming order should be done")
+	}
+
+	for orderID, left := range map[string]int64{"sell-1": 4, "sell-2": 3, "sell-3": 3} {
+		if !market.Order(orderID).Volume.Equal(NewDecimalValue(left)) {
+			t.Fatal("invalid volume left", orderID, market.Order(orderID).Volume)
+		}
+	}
+
+	if !market.sales.Volume.Equal(NewDecimalValue(10)) {
+		t.Fatal("invalid sales volume", market.sales.Volume)
+	}
+}
@@ -0,0 +1,313 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuctionFill is the volume one order received when a batch was cleared
+type AuctionFill struct {
+	OrderID string
+	Kind    Kind
+	Volume  Decimal
+}
+
+// AuctionResult describes a cleared batch
+type AuctionResult struct {
+	Price  Decimal
+	Volume Decimal
+	Fills  []AuctionFill
+}
+
+// BatchAuction is the frequent batch auction matching mode of a Market.
+// Incoming orders are not matched on arrival : they are collected and, on Clear, uncrossed together with the resting
+// book at a single uniform price. Inside a batch only price gives priority - orders at the clearing price share the
+// remaining volume pro-rata, no matter when they arrived.
+// The market should be made WithBatchMode, otherwise it keeps matching its own orders continuously, the ones a batch
+// left resting included. Collected orders are journaled by Clear only : until then, a crash loses them.
+type BatchAuction struct {
+	market  *Market
+	pending []*Order
+	mu      sync.Mutex
+	Lot     Decimal // smallest volume unit handed out by the pro-rata allocation
+}
+
+// errBatchMode refuses the orders sent to a market clearing in batches instead of to its BatchAuction
+var errBatchMode = errors.New("market clears in batches")
+
+// WithBatchMode makes a market clear in batches only : it refuses new orders, market orders and quotes, and amended
+// orders rest without matching, until a BatchAuction clears them
+func WithBatchMode() Option {
+	return func(m *Market) {
+		m.batch = true
+	}
+}
+
+func NewBatchAuction(market *Market) *BatchAuction {
+	return &BatchAuction{
+		market: market,
+		Lot:    NewDecimalValue(1),
+	}
+}
+
+// ProcessBuyOrder collects a buy order for the next batch
+func (a *BatchAuction) ProcessBuyOrder(orderID string, volume, price Decimal) error {
+	return a.collect(NewBuy(orderID, volume, price, time.Time{}))
+}
+
+// ProcessSellOrder collects a sell order for the next batch
+func (a *BatchAuction) ProcessSellOrder(orderID string, volume, price Decimal) error {
+	return a.collect(NewSell(orderID, volume, price, time.Time{}))
+}
+
+func (a *BatchAuction) collect(order *Order) error {
+	if order.Volume.Sign() <= 0 {
+		return errors.New("invalid order volume")
+	}
+
+	if order.Price.Sign() <= 0 {
+		return errors.New("invalid order price")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.market.orders[order.ID]; ok {
+		return errors.New("order already exists")
+	}
+
+	for _, pending := range a.pending {
+		if pending.ID == order.ID {
+			return errors.New("order already exists")
+		}
+	}
+
+	a.pending = append(a.pending, order)
+	return nil
+}
+
+// Pending returns the number of orders waiting for the next batch
+func (a *BatchAuction) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
+
+// Run clears a batch every interval, until the context is done
+func (a *BatchAuction) Run(ctx context.Context, interval time.Duration, results chan<- AuctionResult) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			select {
+			case results <- a.Clear():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Clear moves collected orders into the book and uncrosses it at a uniform price.
+// Orders left unfilled keep resting in the market for the next batch. If the journal fails, the batch stays pending.
+func (a *BatchAuction) Clear() AuctionResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	m := a.market
+	command := Command{Type: AuctionCommand, Lot: a.Lot}
+	for _, order := range a.pending {
+		command.Orders = append(command.Orders, *order)
+	}
+
+	if err := m.begin(command); err != nil {
+		return AuctionResult{Price: NewZeroDecimal(), Volume: NewZeroDecimal()}
+	}
+	defer m.end()
+	defer m.notify()
+
+	for _, order := range a.pending {
+		m.emit(Accepted, *order, nil, "")
+		m.rest(order)
+	}
+	a.pending = nil
+
+	result := AuctionResult{Price: NewZeroDecimal(), Volume: NewZeroDecimal()}
+
+	bestBid, bestAsk := m.buys.MaxPriceQueue(), m.sales.MinPriceQueue()
+	if bestBid == nil || bestAsk == nil || bestBid.Price.LessThan(bestAsk.Price) {
+		return result
+	}
+
+	// crossing levels, best first
+	var buys, sales []*OrderQueue
+	for level := bestBid; level != nil && level.Price.GreaterThanOrEqual(bestAsk.Price); level = m.buys.LessThan(level.Price) {
+		buys = append(buys, level)
+	}
+	for level := bestAsk; level != nil && level.Price.LessThanOrEqual(bestBid.Price); level = m.sales.GreaterThan(level.Price) {
+		sales = append(sales, level)
+	}
+
+	result.Price, result.Volume = clearingPrice(buys, sales)
+
+	buyFills, saleFills := a.allocate(buys, result.Volume), a.allocate(sales, result.Volume)
+	for _, fills := range [][]auctionFill{buyFills, saleFills} {
+		for _, fill := range fills {
+			order := fill.element.Order
+			result.Fills = append(result.Fills, AuctionFill{OrderID: order.ID, Kind: order.Kind, Volume: fill.volume})
+		}
+	}
+
+	// buy fills pair with sell fills in allocation order, each pair trading once at the clearing price. Both orders
+	// rest in the book : the one which rested first is the maker.
+	for len(buyFills) > 0 && len(saleFills) > 0 && !m.halted {
+		buy, sale := &buyFills[0], &saleFills[0]
+		volume := decimalMin(buy.volume, sale.volume)
+
+		maker, taker := buy, sale
+		if sale.element.Order.Seq < buy.element.Order.Seq {
+			maker, taker = sale, buy
+		}
+
+		trade := m.trade(maker.element.Order, taker.element.Order, volume)
+		trade.Price = result.Price
+		a.execute(maker, trade)
+		a.execute(taker, trade)
+
+		if buy.volume = buy.volume.Sub(volume); buy.volume.Sign() <= 0 {
+			buyFills = buyFills[1:]
+		}
+		if sale.volume = sale.volume.Sub(volume); sale.volume.Sign() <= 0 {
+			saleFills = saleFills[1:]
+		}
+	}
+
+	return result
+}
+
+// execute takes the volume of trade off a resting order of the batch and reports it traded
+func (a *BatchAuction) execute(fill *auctionFill, trade *Trade) {
+	m := a.market
+	order := fill.element.Order
+
+	state := *order
+	state.Volume = order.Volume.Sub(trade.Volume)
+	if state.Volume.Sign() <= 0 {
+		m.removeOrder(order.ID)
+	} else {
+		m.broker(order.Kind).Update(fill.element, &state)
+	}
+	m.emit(Traded, state, trade, "")
+}
+
+// clearingPrice picks the price which executes the most volume. Ties are broken by the smallest surplus, then by
+// market pressure (highest price on buy surplus, lowest on sell surplus) and, with no surplus at all, by the middle
+// of the tied prices.
+func clearingPrice(buys, sales []*OrderQueue) (Decimal, Decimal) {
+	candidates := make([]Decimal, 0, len(buys)+len(sales))
+	for _, level := range buys {
+		candidates = append(candidates, level.Price)
+	}
+	for _, level := range sales {
+		candidates = append(candidates, level.Price)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].LessThan(candidates[j]) })
+
+	var (
+		tied             []Decimal
+		bestVolume       = NewZeroDecimal()
+		bestSurplus      Decimal
+		bestBuyerSurplus bool
+	)
+
+	for _, price := range candidates {
+		demand, supply := NewZeroDecimal(), NewZeroDecimal()
+		for _, level := range buys {
+			if level.Price.GreaterThanOrEqual(price) {
+				demand = demand.Add(level.TotalVolume())
+			}
+		}
+		for _, level := range sales {
+			if level.Price.LessThanOrEqual(price) {
+				supply = supply.Add(level.TotalVolume())
+			}
+		}
+
+		volume := decimalMin(demand, supply)
+		surplus := demand.Sub(supply)
+		buyerSurplus := surplus.Sign() > 0
+		surplus = surplus.Abs()
+
+		switch {
+		case len(tied) == 0, volume.GreaterThan(bestVolume),
+			volume.Equal(bestVolume) && surplus.LessThan(bestSurplus):
+			tied = []Decimal{price}
+			bestVolume, bestSurplus, bestBuyerSurplus = volume, surplus, buyerSurplus
+		case volume.Equal(bestVolume) && surplus.Equal(bestSurplus):
+			if len(tied) == 0 || !tied[len(tied)-1].Equal(price) {
+				tied = append(tied, price)
+			}
+		}
+	}
+
+	switch {
+	case bestSurplus.Sign() == 0:
+		return tied[0].Add(tied[len(tied)-1]).Div(NewDecimalValue(2)), bestVolume
+	case bestBuyerSurplus:
+		return tied[len(tied)-1], bestVolume
+	default:
+		return tied[0], bestVolume
+	}
+}
+
+type auctionFill struct {
+	element *LinkedListElement
+	volume  Decimal
+}
+
+// allocate hands volume to the levels in price priority. The level which can't be filled entirely shares what is
+// left pro-rata : orders are ranked by ID, so that arrival time does not matter.
+func (a *BatchAuction) allocate(levels []*OrderQueue, volume Decimal) []auctionFill {
+	var result []auctionFill
+
+	for _, level := range levels {
+		if volume.Sign() <= 0 {
+			break
+		}
+
+		var elements []*LinkedListElement
+		for e := level.Head(); e != nil; e = level.Next(e) {
+			elements = append(elements, e)
+		}
+
+		if volume.GreaterThanOrEqual(level.TotalVolume()) {
+			for _, e := range elements {
+				result = append(result, auctionFill{element: e, volume: e.Order.Volume})
+			}
+			volume = volume.Sub(level.TotalVolume())
+			continue
+		}
+
+		sort.Slice(elements, func(i, j int) bool { return elements[i].Order.ID < elements[j].Order.ID })
+		sizes := make([]Decimal, len(elements))
+		for i, e := range elements {
+			sizes[i] = e.Order.Volume
+		}
+
+		for i, allocated := range proRata(volume, sizes, a.Lot, NewZeroDecimal(), true) {
+			if allocated.Sign() > 0 {
+				result = append(result, auctionFill{element: elements[i], volume: allocated})
+			}
+		}
+		volume = NewZeroDecimal()
+	}
+
+	return result
+}
@@ -0,0 +1,155 @@
+package market
+
+import (
+	"testing"
+)
+
+func TestBatchAuctionUniformPrice(t *testing.T) {
+	var events []Event
+	market := NewMarket(WithListener(ListenerFunc(func(event Event) { events = append(events, event) })))
+	ticker := NewTicker(market)
+	auction := NewBatchAuction(market)
+
+	if err := auction.ProcessSellOrder("sell-1", NewDecimalValue(5), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := auction.ProcessSellOrder("sell-2", NewDecimalValue(5), NewDecimalValue(102)); err != nil {
+		t.Fatal(err)
+	}
+	if err := auction.ProcessBuyOrder("buy-1", NewDecimalValue(4), NewDecimalValue(105)); err != nil {
+		t.Fatal(err)
+	}
+	if err := auction.ProcessBuyOrder("buy-2", NewDecimalValue(4), NewDecimalValue(102)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := auction.ProcessBuyOrder("buy-1", NewDecimalValue(4), NewDecimalValue(102)); err == nil {
+		t.Fatal("should not be possible to collect an existing order")
+	}
+
+	if market.Order("sell-1") != nil {
+		t.Fatal("orders should not reach the book before the batch is cleared")
+	}
+
+	result := auction.Clear()
+	if !result.Volume.Equal(NewDecimalValue(8)) {
+		t.Fatal("invalid cleared volume", result.Volume)
+	}
+
+	if !result.Price.Equal(NewDecimalValue(102)) {
+		t.Fatal("invalid clearing price", result.Price)
+	}
+
+	if len(result.Fills) != 4 {
+		t.Fatal("invalid fills count", len(result.Fills))
+	}
+
+	if market.Order("buy-1") != nil || market.Order("buy-2") != nil || market.Order("sell-1") != nil {
+		t.Fatal("filled orders should leave the book")
+	}
+
+	left := market.Order("sell-2")
+	if left == nil || !left.Volume.Equal(NewDecimalValue(2)) {
+		t.Fatal("sell-2 should rest with 2 pcs")
+	}
+
+	if auction.Pending() != 0 {
+		t.Fatal("batch should be empty after clearing")
+	}
+
+	// buys pair with sells, each pair trades once : the sells rested first, so they are the makers
+	expected := []struct {
+		maker, taker string
+		volume       int64
+	}{{"sell-1", "buy-1", 4}, {"sell-1", "buy-2", 1}, {"sell-2", "buy-2", 3}}
+
+	var trades []*Trade
+	for _, event := range events {
+		if event.Type != Traded {
+			continue
+		}
+		if !event.MakerTrade() {
+			if len(trades) == 0 || event.Trade != trades[len(trades)-1] || event.Order.ID != event.Trade.TakerOrderID {
+				t.Fatal("taker event should follow the maker one of its trade", event.Order.ID)
+			}
+			continue
+		}
+		trades = append(trades, event.Trade)
+	}
+
+	if len(trades) != len(expected) {
+		t.Fatal("invalid trades count", len(trades))
+	}
+	for i, trade := range trades {
+		if trade.MakerOrderID != expected[i].maker || trade.TakerOrderID != expected[i].taker || trade.Aggressor != Buy ||
+			!trade.Volume.Equal(NewDecimalValue(expected[i].volume)) || !trade.Price.Equal(NewDecimalValue(102)) {
+			t.Fatalf("invalid trade %+v", trade)
+		}
+	}
+
+	if bbo := ticker.BBO(); !bbo.SessionVolume.Equal(NewDecimalValue(8)) {
+		t.Fatal("auction volume should be counted once", bbo.SessionVolume)
+	}
+}
+
+func TestBatchAuctionIgnoresArrival(t *testing.T) {
+	for _, arrival := range [][]string{{"buy-a", "buy-b"}, {"buy-b", "buy-a"}} {
+		market := NewMarket()
+		auction := NewBatchAuction(market)
+
+		for _, orderID := range arrival {
+			if err := auction.ProcessBuyOrder(orderID, NewDecimalValue(6), NewDecimalValue(100)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := auction.ProcessSellOrder("sell", NewDecimalValue(7), NewDecimalValue(100)); err != nil {
+			t.Fatal(err)
+		}
+
+		result := auction.Clear()
+		if !result.Volume.Equal(NewDecimalValue(7)) || !result.Price.Equal(NewDecimalValue(100)) {
+			t.Fatal("invalid batch result", result.Price, result.Volume)
+		}
+
+		// 3.5 each, rounded down to 3 and the residue lot goes to the first by ID
+		if !market.Order("buy-a").Volume.Equal(NewDecimalValue(2)) || !market.Order("buy-b").Volume.Equal(NewDecimalValue(3)) {
+			t.Fatal("pro-rata allocation should not depend on arrival", arrival)
+		}
+	}
+}
+
+func TestBatchMode(t *testing.T) {
+	market := NewMarket(WithBatchMode())
+	auction := NewBatchAuction(market)
+
+	if err := auction.ProcessSellOrder("sell-1", NewDecimalValue(5), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := auction.ProcessBuyOrder("buy-1", NewDecimalValue(2), NewDecimalValue(90)); err != nil {
+		t.Fatal(err)
+	}
+	auction.Clear()
+
+	// the batch left both orders resting : continuous orders are refused instead of matching them
+	if _, _, _, err := market.ProcessBuyOrder("buy-2", NewDecimalValue(1), NewDecimalValue(100)); err == nil || market.Order("buy-2") != nil {
+		t.Fatal("batch mode market should refuse orders", err)
+	}
+	if _, _, _, _, err := market.ProcessBuy(NewDecimalValue(1)); err == nil {
+		t.Fatal("batch mode market should refuse market orders")
+	}
+	if _, err := market.Quote("maker", Quote{BidPrice: NewDecimalValue(100), BidVolume: NewDecimalValue(1)}); err == nil {
+		t.Fatal("batch mode market should refuse quotes")
+	}
+
+	// an amended order crossing the book waits for the next batch
+	if trades, err := market.AmendOrder("buy-1", NewDecimalValue(2), NewDecimalValue(100)); err != nil || len(trades) != 0 {
+		t.Fatal("amended order should rest without matching", trades, err)
+	}
+	if !market.Order("sell-1").Volume.Equal(NewDecimalValue(5)) {
+		t.Fatal("resting orders should not match continuously")
+	}
+
+	if result := auction.Clear(); !result.Volume.Equal(NewDecimalValue(2)) {
+		t.Fatal("batch should clear the amended order", result.Volume)
+	}
+}
@@ -0,0 +1,305 @@
+package market
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditStage is a step of the lifecycle of an order
+type AuditStage string
+
+const (
+	AuditReceived        AuditStage = "received"
+	AuditValidated       AuditStage = "validated"
+	AuditRested          AuditStage = "rested"
+	AuditPartiallyFilled AuditStage = "partially filled"
+	AuditFilled          AuditStage = "filled"
+	AuditAmended         AuditStage = "amended"
+	AuditCancelled       AuditStage = "cancelled"
+	AuditExpired         AuditStage = "expired"
+	AuditRejected        AuditStage = "rejected"
+)
+
+// AuditRecord is a transition of an order. Seq is the sequence number of the event which made it : the received and
+// validated stages of an order share one, so do both sides of a trade. Volume is what the transition is about, the
+// order volume or the traded one for fills, Remaining is the volume the order has left afterwards.
+type AuditRecord struct {
+	Time      time.Time  `json:"time"`
+	Seq       uint64     `json:"seq"`
+	Stage     AuditStage `json:"stage"`
+	OrderID   string     `json:"order_id"`
+	Account   string     `json:"account,omitempty"`
+	Side      string     `json:"side"`
+	Price     Decimal    `json:"price"`
+	Volume    Decimal    `json:"volume"`
+	Remaining Decimal    `json:"remaining"`
+	TradeID   uint64     `json:"trade_id,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+var auditHeader = []string{"time", "seq", "stage", "order_id", "account", "side", "price", "volume", "remaining", "trade_id", "reason"}
+
+func (r *AuditRecord) csv() []string {
+	tradeID := ""
+	if r.TradeID != 0 {
+		tradeID = strconv.FormatUint(r.TradeID, 10)
+	}
+
+	return []string{r.Time.Format(time.RFC3339Nano), strconv.FormatUint(r.Seq, 10), string(r.Stage), r.OrderID, r.Account,
+		r.Side, r.Price.String(), r.Volume.String(), r.Remaining.String(), tradeID, r.Reason}
+}
+
+const (
+	auditPrefix = "audit-"
+	auditCSV    = ".csv"
+	auditJSONL  = ".jsonl"
+)
+
+// AuditWriter is a Listener writing the lifecycle of the orders of a market as an audit trail : each transition is a
+// row of a CSV file and a line of a JSON-lines file. Both files rotate together every maxRecords records, numbered
+// after the ones already in the directory. Fills of the incoming order are derived from the trades, the other
+// stages from the events. Once a write fails the writer stops, Err tells why.
+type AuditWriter struct {
+	dir        string
+	maxRecords int
+
+	part    int
+	records int
+	files   []*os.File
+	csv     *csv.Writer
+	jsonl   *bufio.Writer
+
+	incoming incoming
+
+	err error
+}
+
+// NewAuditWriter writes the audit trail files in dir, rotating them every maxRecords records, or never if zero
+func NewAuditWriter(dir string, maxRecords int) (*AuditWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	parts, err := auditParts(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AuditWriter{dir: dir, maxRecords: maxRecords}
+	if len(parts) > 0 {
+		result.part = parts[len(parts)-1]
+	}
+	return result, nil
+}
+
+// auditParts returns the numbers of the JSON-lines files of dir, in order
+func auditParts(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, auditPrefix) || !strings.HasSuffix(name, auditJSONL) {
+			continue
+		}
+
+		if part, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, auditPrefix), auditJSONL)); err == nil {
+			result = append(result, part)
+		}
+	}
+
+	sort.Ints(result)
+	return result, nil
+}
+
+func (a *AuditWriter) path(part int, suffix string) string {
+	return filepath.Join(a.dir, fmt.Sprintf("%s%06d%s", auditPrefix, part, suffix))
+}
+
+func (a *AuditWriter) OnEvent(event Event) {
+	order := event.Order
+	record := func(order Order, stage AuditStage, volume, remaining Decimal) AuditRecord {
+		return AuditRecord{Time: event.Time, Seq: event.Seq, Stage: stage, OrderID: order.ID, Account: order.Account,
+			Side: order.Kind.String(), Price: order.Price, Volume: volume, Remaining: remaining, Reason: event.Reason}
+	}
+
+	taker := a.incoming.track(event)
+	switch event.Type {
+	case Accepted:
+		a.write(record(order, AuditReceived, order.Volume, order.Volume))
+		a.write(record(order, AuditValidated, order.Volume, order.Volume))
+	case Rejected:
+		a.write(record(order, AuditReceived, order.Volume, order.Volume))
+		a.write(record(order, AuditRejected, order.Volume, NewZeroDecimal()))
+	case Rested:
+		a.write(record(order, AuditRested, order.Volume, order.Volume))
+	case Traded:
+		a.write(fill(record(order, AuditFilled, event.Trade.Volume, order.Volume), event.Trade))
+
+		if taker != nil {
+			a.write(fill(record(*taker, AuditFilled, event.Trade.Volume, taker.Volume), event.Trade))
+		}
+	case Amended:
+		a.write(record(order, AuditAmended, order.Volume, order.Volume))
+	case Cancelled:
+		a.write(record(order, AuditCancelled, order.Volume, NewZeroDecimal()))
+	case Expired:
+		a.write(record(order, AuditExpired, order.Volume, NewZeroDecimal()))
+	}
+}
+
+// fill completes the record of a side of trade, filled unless some volume remains
+func fill(record AuditRecord, trade *Trade) AuditRecord {
+	if record.Remaining.Sign() > 0 {
+		record.Stage = AuditPartiallyFilled
+	}
+	record.Price, record.TradeID = trade.Price, trade.ID
+	return record
+}
+
+func (a *AuditWriter) write(record AuditRecord) {
+	if a.err != nil {
+		return
+	}
+
+	if a.files == nil || (a.maxRecords > 0 && a.records >= a.maxRecords) {
+		if a.err = a.rotate(); a.err != nil {
+			return
+		}
+	}
+
+	line, err := json.Marshal(&record)
+	if err != nil {
+		a.err = err
+		return
+	}
+
+	if a.err = a.csv.Write(record.csv()); a.err != nil {
+		return
+	}
+
+	if _, a.err = a.jsonl.Write(append(line, '\n')); a.err != nil {
+		return
+	}
+	a.records++
+}
+
+// rotate closes the current files and starts the next part
+func (a *AuditWriter) rotate() error {
+	if err := a.Close(); err != nil {
+		return err
+	}
+
+	a.part++
+	a.records = 0
+	for _, suffix := range []string{auditCSV, auditJSONL} {
+		file, err := os.OpenFile(a.path(a.part, suffix), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			a.closeFiles()
+			return err
+		}
+		a.files = append(a.files, file)
+	}
+
+	a.csv = csv.NewWriter(a.files[0])
+	a.jsonl = bufio.NewWriter(a.files[1])
+	return a.csv.Write(auditHeader)
+}
+
+// Flush writes the buffered records to the files
+func (a *AuditWriter) Flush() error {
+	if a.err != nil || a.files == nil {
+		return a.err
+	}
+
+	a.csv.Flush()
+	if err := a.csv.Error(); err != nil {
+		a.err = err
+		return err
+	}
+
+	if err := a.jsonl.Flush(); err != nil {
+		a.err = err
+		return err
+	}
+	return nil
+}
+
+// Err returns the write error which stopped the writer, if any
+func (a *AuditWriter) Err() error {
+	return a.err
+}
+
+// Close flushes and closes the current files. Further records start a new part.
+func (a *AuditWriter) Close() error {
+	err := a.Flush()
+	if closeErr := a.closeFiles(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (a *AuditWriter) closeFiles() error {
+	var result error
+	for _, file := range a.files {
+		if err := file.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	a.files = nil
+	return result
+}
+
+// ReadAudit returns the history of an order from the JSON-lines files of an audit trail, oldest first
+func ReadAudit(dir, orderID string) ([]AuditRecord, error) {
+	parts, err := auditParts(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := AuditWriter{dir: dir}
+	var result []AuditRecord
+	for _, part := range parts {
+		file, err := os.Open(writer.path(part, auditJSONL))
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+		for line := 1; scanner.Scan(); line++ {
+			var record AuditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("%s line %d : %w", filepath.Base(file.Name()), line, err)
+			}
+
+			if record.OrderID == orderID {
+				result = append(result, record)
+			}
+		}
+
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New("no audit record for order " + orderID)
+	}
+	return result, nil
+}
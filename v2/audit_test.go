@@ -0,0 +1,114 @@
+package market
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuditTrail(t *testing.T) {
+	dir := t.TempDir()
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+
+	audit, err := NewAuditWriter(dir, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	market := NewMarket(WithClock(func() time.Time { return engineTime }), WithListener(audit))
+
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(5), NewDecimalValue(101)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessOrder(&Order{ID: "sell-2", Kind: Sell, Volume: NewDecimalValue(3), Price: NewDecimalValue(102), ExpiresAt: engineTime.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(7), NewDecimalValue(101)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := market.AmendOrder("buy-1", NewDecimalValue(4), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(1), NewDecimalValue(90)); err == nil {
+		t.Fatal("duplicate order should be rejected")
+	}
+	market.CancelOrder("buy-1")
+	market.ExpireOrders(engineTime.Add(2 * time.Hour))
+
+	if err := audit.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, expected := range map[string][]AuditStage{
+		"sell-1": {AuditReceived, AuditValidated, AuditRested, AuditFilled},
+		"sell-2": {AuditReceived, AuditValidated, AuditRested, AuditExpired},
+		"buy-1":  {AuditReceived, AuditValidated, AuditPartiallyFilled, AuditRested, AuditAmended, AuditRested, AuditReceived, AuditRejected, AuditCancelled},
+	} {
+		history, err := ReadAudit(dir, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stages []AuditStage
+		for i, record := range history {
+			stages = append(stages, record.Stage)
+			if i > 0 && record.Seq < history[i-1].Seq {
+				t.Fatal("history out of sequence", id)
+			}
+		}
+		if !reflect.DeepEqual(stages, expected) {
+			t.Fatal("invalid history", id, stages)
+		}
+	}
+
+	history, _ := ReadAudit(dir, "buy-1")
+	if fill := history[2]; !fill.Price.Equal(NewDecimalValue(101)) || !fill.Volume.Equal(NewDecimalValue(5)) || !fill.Remaining.Equal(NewDecimalValue(2)) ||
+		fill.TradeID != 1 || fill.Side != "buy" || !fill.Time.Equal(engineTime) {
+		t.Fatalf("invalid taker fill %+v", fill)
+	}
+	if rested := history[3]; !rested.Remaining.Equal(NewDecimalValue(2)) {
+		t.Fatalf("invalid rested %+v", rested)
+	}
+	if rejected := history[7]; rejected.Reason == "" {
+		t.Fatal("rejection should tell why")
+	}
+
+	if _, err := ReadAudit(dir, "unknown"); err == nil {
+		t.Fatal("unknown order should have no history")
+	}
+
+	// 17 records, 5 a file
+	parts, err := auditParts(dir)
+	if err != nil || !reflect.DeepEqual(parts, []int{1, 2, 3, 4}) {
+		t.Fatal("invalid audit files", parts, err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "audit-000001.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 6 || !reflect.DeepEqual(rows[0], auditHeader) || rows[1][2] != string(AuditReceived) || rows[1][3] != "sell-1" {
+		t.Fatal("invalid CSV audit file", rows)
+	}
+
+	// a new writer goes on after the existing files
+	audit, err = NewAuditWriter(dir, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit.OnEvent(Event{Type: Cancelled, Order: Order{ID: "sell-3"}})
+	if err := audit.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audit-000005.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -73,3 +73,17 @@ func BenchmarkQueue(b *testing.B) {
 	elapsed := time.Since(stopwatch)
 	fmt.Printf("elapsed: %s -\t\t\t %d run(s) added %f orders to queue per second\n", elapsed, b.N, float64(b.N)/elapsed.Seconds())
 }
+
+func BenchmarkDeepLevel(b *testing.B) {
+	market := NewMarket()
+	for i := 0; i < 20000; i++ {
+		if _, _, _, err := market.ProcessSellOrder(fmt.Sprintf("sell-%d", i), NewDecimalValue(1000000), NewDecimalValue(100)); err != nil {
+			panic("error : " + err.Error())
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _, _ = market.ProcessBuyOrder(fmt.Sprintf("buy-%d", i), NewDecimalValue(1), NewDecimalValue(100))
+	}
+}
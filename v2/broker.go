@@ -1,21 +1,32 @@
 package market
 
 type Broker struct {
-	tree   *RedBlackTree
-	prices map[string]*OrderQueue
-	Volume Decimal
-	Len    int
-	Depth  int
+	tree         *RedBlackTree
+	prices       map[string]*OrderQueue
+	Volume       Decimal // displayed volume
+	HiddenVolume Decimal
+	Len          int
+	Depth        int
 }
 
 func NewBroker() *Broker {
 	return &Broker{
-		tree:   &RedBlackTree{},
-		prices: map[string]*OrderQueue{},
-		Volume: NewZeroDecimal(),
+		tree:         &RedBlackTree{},
+		prices:       map[string]*OrderQueue{},
+		Volume:       NewZeroDecimal(),
+		HiddenVolume: NewZeroDecimal(),
 	}
 }
 
+// addVolume accounts volume of the order as displayed or hidden
+func (m *Broker) addVolume(order *Order, volume Decimal) {
+	if order.Hidden {
+		m.HiddenVolume = m.HiddenVolume.Add(volume)
+		return
+	}
+	m.Volume = m.Volume.Add(volume)
+}
+
 // Add appends order to definite price level
 func (m *Broker) Add(order *Order) *LinkedListElement {
 	price := order.Price
@@ -30,7 +41,7 @@ func (m *Broker) Add(order *Order) *LinkedListElement {
 	}
 
 	m.Len++
-	m.Volume = m.Volume.Add(order.Volume)
+	m.addVolume(order, order.Volume)
 	return queue.Add(order)
 }
 
@@ -49,10 +60,16 @@ func (m *Broker) Remove(e *LinkedListElement) *Order {
 	}
 
 	m.Len--
-	m.Volume = m.Volume.Sub(o.Volume)
+	m.addVolume(o, o.Volume.Neg())
 	return o
 }
 
+// Update replaces the order of an element, keeping its place in the price level
+func (m *Broker) Update(e *LinkedListElement, order *Order) *LinkedListElement {
+	m.addVolume(e.Order, order.Volume.Sub(e.Order.Volume))
+	return m.prices[e.Order.Price.String()].Update(e, order)
+}
+
 // MaxPriceQueue returns maximal level of price
 func (m *Broker) MaxPriceQueue() *OrderQueue {
 	if m.Depth <= 0 {
@@ -122,3 +139,8 @@ func (m *Broker) GreaterThan(price Decimal) *OrderQueue {
 
 	return nil
 }
+
+// Level returns the price level at price, or nil
+func (m *Broker) Level(price Decimal) *OrderQueue {
+	return m.prices[price.String()]
+}
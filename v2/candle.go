@@ -0,0 +1,256 @@
+package market
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CandleIntervals are the intervals of Candles when none is given
+var CandleIntervals = []time.Duration{time.Second, time.Minute, 5 * time.Minute, time.Hour, 24 * time.Hour}
+
+// CandleRetention is the number of closed candles of each interval Candles keep when Retention is not set
+var CandleRetention = 1000
+
+// Candle is the OHLCV summary of the trades of one interval, starting at Start. An interval without trades makes a
+// flat candle at the previous close, with no volume, and with VWAP at that close as well.
+type Candle struct {
+	Start    time.Time
+	Interval time.Duration
+	Open     Decimal
+	High     Decimal
+	Low      Decimal
+	Close    Decimal
+	Volume   Decimal
+	VWAP     Decimal
+	Trades   int
+
+	turnover Decimal // sum of price * volume
+}
+
+// End returns the time the candle closes at
+func (c Candle) End() time.Time {
+	return c.Start.Add(c.Interval)
+}
+
+func (c *Candle) add(trade *Trade) {
+	if c.Trades == 0 {
+		c.Open, c.High, c.Low = trade.Price, trade.Price, trade.Price
+	}
+
+	if trade.Price.GreaterThan(c.High) {
+		c.High = trade.Price
+	}
+	if trade.Price.LessThan(c.Low) {
+		c.Low = trade.Price
+	}
+
+	c.Close = trade.Price
+	c.Volume = c.Volume.Add(trade.Volume)
+	c.turnover = c.turnover.Add(trade.Price.Mul(trade.Volume))
+	c.VWAP = c.turnover.Div(c.Volume)
+	c.Trades++
+}
+
+// candleSeries holds the candles of one interval
+type candleSeries struct {
+	interval time.Duration
+	current  *Candle  // candle taking trades, if any
+	closed   []Candle // by start time
+}
+
+// last returns the latest candle, open or closed
+func (s *candleSeries) last() *Candle {
+	if s.current != nil {
+		return s.current
+	}
+
+	if len(s.closed) > 0 {
+		return &s.closed[len(s.closed)-1]
+	}
+
+	return nil
+}
+
+// bucket returns the start of the interval of t. Late trades, stamped before the latest candle, are not allowed to
+// reopen the past and go to the latest interval still open.
+func (s *candleSeries) bucket(t time.Time) time.Time {
+	result := t.Truncate(s.interval)
+	if s.current != nil && result.Before(s.current.Start) {
+		return s.current.Start
+	}
+
+	if s.current == nil && len(s.closed) > 0 && result.Before(s.closed[len(s.closed)-1].End()) {
+		return s.closed[len(s.closed)-1].End()
+	}
+
+	return result
+}
+
+// advance closes the candles which ended by now, filling intervals without trades with flat candles. Only the last
+// retention of them are made after a long idle time, and only retention closed candles are kept.
+func (s *candleSeries) advance(now time.Time, retention int, onClose func(Candle)) {
+	defer s.trim(retention)
+
+	last := s.last()
+	if last == nil {
+		return
+	}
+
+	start := s.bucket(now)
+	if s.current != nil {
+		if s.current.Start.Equal(start) {
+			return
+		}
+
+		s.closed = append(s.closed, *s.current)
+		s.current = nil
+		if onClose != nil {
+			onClose(*last)
+		}
+	}
+
+	previous := s.closed[len(s.closed)-1]
+	next := previous.End()
+	if skipped := start.Sub(next)/s.interval - time.Duration(retention); skipped > 0 {
+		next = next.Add(skipped * s.interval)
+	}
+
+	for ; next.Before(start); next = next.Add(s.interval) {
+		empty := Candle{
+			Start:    next,
+			Interval: s.interval,
+			Open:     previous.Close,
+			High:     previous.Close,
+			Low:      previous.Close,
+			Close:    previous.Close,
+			Volume:   NewZeroDecimal(),
+			VWAP:     previous.Close,
+			turnover: NewZeroDecimal(),
+		}
+
+		s.closed = append(s.closed, empty)
+		if onClose != nil {
+			onClose(empty)
+		}
+	}
+}
+
+// trim drops the oldest closed candles beyond retention
+func (s *candleSeries) trim(retention int) {
+	if extra := len(s.closed) - retention; extra > 0 {
+		s.closed = s.closed[extra:]
+	}
+}
+
+func (s *candleSeries) add(trade *Trade, retention int, onClose func(Candle)) {
+	s.advance(trade.Time, retention, onClose)
+
+	if s.current == nil {
+		s.current = &Candle{Start: s.bucket(trade.Time), Interval: s.interval, Volume: NewZeroDecimal(), turnover: NewZeroDecimal()}
+	}
+	s.current.add(trade)
+}
+
+// Candles aggregates the trades of a market into OHLCV candles of several intervals, using the trade times given by
+// the market clock. Intervals are aligned on UTC. A candle closes when a trade or a call to Advance reaches the next
+// interval, which is reported to the close callback. Queries are safe from any goroutine, except from the callback.
+// Each interval keeps its last Retention closed candles, and a long idle time makes no more flat candles than that.
+type Candles struct {
+	Retention int // closed candles kept per interval, CandleRetention when zero. Set it before the first trade.
+
+	mu      sync.Mutex
+	series  map[time.Duration]*candleSeries
+	onClose func(Candle)
+}
+
+func NewCandles(market *Market, onClose func(Candle), intervals ...time.Duration) (*Candles, error) {
+	if len(intervals) == 0 {
+		intervals = CandleIntervals
+	}
+
+	result := &Candles{series: map[time.Duration]*candleSeries{}, onClose: onClose}
+	for _, interval := range intervals {
+		if interval <= 0 {
+			return nil, errors.New("invalid candle interval")
+		}
+		result.series[interval] = &candleSeries{interval: interval}
+	}
+
+	market.listen(result)
+	return result, nil
+}
+
+func (c *Candles) OnEvent(event Event) {
+	if !event.MakerTrade() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, series := range c.sorted() {
+		series.add(event.Trade, c.retention(), c.onClose)
+	}
+}
+
+// sorted returns the series from the shortest interval, so candles close in a deterministic order
+func (c *Candles) sorted() []*candleSeries {
+	result := make([]*candleSeries, 0, len(c.series))
+	for _, series := range c.series {
+		result = append(result, series)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].interval < result[j].interval })
+	return result
+}
+
+func (c *Candles) retention() int {
+	if c.Retention > 0 {
+		return c.Retention
+	}
+	return CandleRetention
+}
+
+// Advance closes the candles which ended by now, when no trade did it
+func (c *Candles) Advance(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, series := range c.sorted() {
+		series.advance(now, c.retention(), c.onClose)
+	}
+}
+
+// Current returns the candle of interval still taking trades
+func (c *Candles) Current(interval time.Duration) (Candle, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	series, ok := c.series[interval]
+	if !ok || series.current == nil {
+		return Candle{}, false
+	}
+
+	return *series.current, true
+}
+
+// History returns the closed candles of interval starting in [from, to)
+func (c *Candles) History(interval time.Duration, from, to time.Time) []Candle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	series, ok := c.series[interval]
+	if !ok {
+		return nil
+	}
+
+	first := sort.Search(len(series.closed), func(i int) bool { return !series.closed[i].Start.Before(from) })
+	last := sort.Search(len(series.closed), func(i int) bool { return !series.closed[i].Start.Before(to) })
+	if first >= last {
+		return nil
+	}
+
+	return append([]Candle(nil), series.closed[first:last]...)
+}
@@ -0,0 +1,101 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCandles(t *testing.T) {
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	market := NewMarket(WithClock(func() time.Time { return engineTime }))
+
+	var closed []Candle
+	candles, err := NewCandles(market, func(candle Candle) { closed = append(closed, candle) }, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewCandles(market, nil, 0); err == nil {
+		t.Fatal("should not be possible to use an empty interval")
+	}
+
+	trade := func(volume, price int) {
+		if _, _, _, err := market.ProcessSellOrder("sell", NewDecimalValue(int64(volume)), NewDecimalValue(int64(price))); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := market.ProcessBuyOrder("buy", NewDecimalValue(int64(volume)), NewDecimalValue(int64(price))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trade(1, 100)
+	engineTime = engineTime.Add(10 * time.Second)
+	trade(3, 104)
+	engineTime = engineTime.Add(10 * time.Second)
+	trade(2, 97)
+
+	current, ok := candles.Current(time.Minute)
+	if !ok || !current.Open.Equal(NewDecimalValue(100)) || !current.High.Equal(NewDecimalValue(104)) || !current.Low.Equal(NewDecimalValue(97)) ||
+		!current.Close.Equal(NewDecimalValue(97)) || !current.Volume.Equal(NewDecimalValue(6)) || !current.VWAP.Equal(NewDecimalValue(101)) || current.Trades != 3 {
+		t.Fatal("invalid current candle", current)
+	}
+
+	// three minutes later, the first candle closes and two flat candles fill the gap
+	engineTime = engineTime.Add(3 * time.Minute)
+	trade(1, 110)
+
+	if len(closed) != 3 || !closed[0].Close.Equal(NewDecimalValue(97)) || closed[1].Trades != 0 || !closed[2].Open.Equal(NewDecimalValue(97)) ||
+		!closed[2].VWAP.Equal(NewDecimalValue(97)) || closed[2].Volume.Sign() != 0 {
+		t.Fatal("invalid closed candles", closed)
+	}
+
+	history := candles.History(time.Minute, engineTime.Add(-2*time.Minute).Truncate(time.Minute), engineTime)
+	if len(history) != 2 || !history[0].Start.Equal(time.Date(2022, 11, 1, 10, 1, 0, 0, time.UTC)) {
+		t.Fatal("invalid history", history)
+	}
+
+	// no trade needed to close the candles
+	candles.Advance(engineTime.Add(time.Hour))
+	if len(closed) != 3+1+59+1 {
+		t.Fatal("invalid closed candles count", len(closed))
+	}
+
+	hours := candles.History(time.Hour, time.Time{}, engineTime.Add(2*time.Hour))
+	if len(hours) != 1 || hours[0].Trades != 4 || !hours[0].High.Equal(NewDecimalValue(110)) {
+		t.Fatal("invalid hour candle", hours)
+	}
+
+	if _, ok := candles.Current(time.Minute); ok {
+		t.Fatal("no candle should be open")
+	}
+}
+
+func TestCandlesRetention(t *testing.T) {
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	market := NewMarket(WithClock(func() time.Time { return engineTime }))
+
+	var closed []Candle
+	candles, err := NewCandles(market, func(candle Candle) { closed = append(closed, candle) }, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candles.Retention = 3
+
+	if _, _, _, err := market.ProcessSellOrder("sell", NewDecimalValue(1), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessBuyOrder("buy", NewDecimalValue(1), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// ten idle minutes only make the flat candles kept
+	candles.Advance(engineTime.Add(10 * time.Minute))
+	if len(closed) != 1+3 || !closed[1].Start.Equal(time.Date(2022, 11, 1, 10, 7, 0, 0, time.UTC)) {
+		t.Fatal("invalid closed candles", closed)
+	}
+
+	history := candles.History(time.Minute, engineTime, engineTime.Add(time.Hour))
+	if len(history) != 3 || history[0].Trades != 0 || !history[2].Start.Equal(time.Date(2022, 11, 1, 10, 9, 0, 0, time.UTC)) {
+		t.Fatal("invalid retained history", history)
+	}
+}
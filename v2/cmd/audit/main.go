@@ -0,0 +1,44 @@
+// Command audit prints the history of an order from an audit trail written by market.AuditWriter
+//
+//	audit -dir ./audit -order buy-1
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	market "github.com/badu/matchengine/v2"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the audit trail files")
+	orderID := flag.String("order", "", "ID of the order")
+	flag.Parse()
+
+	if *orderID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	history, err := market.ReadAudit(*dir, *orderID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSEQ\tSTAGE\tSIDE\tPRICE\tVOLUME\tREMAINING\tTRADE\tACCOUNT\tREASON")
+	for _, record := range history {
+		trade := ""
+		if record.TradeID != 0 {
+			trade = fmt.Sprint(record.TradeID)
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", record.Time.Format(time.RFC3339Nano), record.Seq, record.Stage,
+			record.Side, record.Price, record.Volume, record.Remaining, trade, record.Account, record.Reason)
+	}
+	w.Flush()
+}
@@ -0,0 +1,173 @@
+package market
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var errCorrupted = errors.New("corrupted data")
+
+// encoder appends values to a buffer in the compact binary form used by the journal and snapshots.
+// Decimals keep their exact coefficient and exponent, times are stored in UTC.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(value uint64) {
+	e.buf = binary.AppendUvarint(e.buf, value)
+}
+
+func (e *encoder) int(value int64) {
+	e.buf = binary.AppendVarint(e.buf, value)
+}
+
+func (e *encoder) bool(value bool) {
+	if value {
+		e.buf = append(e.buf, 1)
+		return
+	}
+	e.buf = append(e.buf, 0)
+}
+
+func (e *encoder) bytes(value []byte) {
+	e.uint(uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *encoder) string(value string) {
+	e.uint(uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *encoder) decimal(value Decimal) {
+	// zero keeps the exponent of its computation, which would make equal states encode differently
+	if value.IsZero() {
+		value = Decimal{}
+	}
+
+	coefficient := value.Coefficient()
+	e.bool(coefficient.Sign() < 0)
+	e.bytes(coefficient.Bytes())
+	e.int(int64(value.Exponent()))
+}
+
+func (e *encoder) time(value time.Time) {
+	e.bool(value.IsZero())
+	if value.IsZero() {
+		return
+	}
+
+	e.int(value.Unix())
+	e.uint(uint64(value.Nanosecond()))
+}
+
+func (e *encoder) order(order *Order) {
+	e.time(order.Time)
+	e.time(order.ExpiresAt)
+	e.uint(order.Seq)
+	e.string(order.ID)
+	e.string(order.Account)
+	e.decimal(order.Volume)
+	e.decimal(order.Price)
+	e.uint(uint64(order.Kind))
+	e.bool(order.Hidden)
+}
+
+// decoder reads what encoder wrote. The first error sticks : later reads return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errCorrupted
+	}
+	d.buf = nil
+}
+
+func (d *decoder) uint() uint64 {
+	value, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+
+	d.buf = d.buf[n:]
+	return value
+}
+
+func (d *decoder) int() int64 {
+	value, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+
+	d.buf = d.buf[n:]
+	return value
+}
+
+func (d *decoder) bool() bool {
+	if len(d.buf) == 0 {
+		d.fail()
+		return false
+	}
+
+	value := d.buf[0]
+	d.buf = d.buf[1:]
+	return value == 1
+}
+
+func (d *decoder) bytes() []byte {
+	size := d.uint()
+	if size > uint64(len(d.buf)) {
+		d.fail()
+		return nil
+	}
+
+	value := d.buf[:size]
+	d.buf = d.buf[size:]
+	return value
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) decimal() Decimal {
+	negative := d.bool()
+	coefficient := new(big.Int).SetBytes(d.bytes())
+	if negative {
+		coefficient.Neg(coefficient)
+	}
+
+	return decimal.NewFromBigInt(coefficient, int32(d.int()))
+}
+
+func (d *decoder) time() time.Time {
+	if d.bool() {
+		return time.Time{}
+	}
+
+	seconds := d.int()
+	return time.Unix(seconds, int64(d.uint())).UTC()
+}
+
+func (d *decoder) order() *Order {
+	return &Order{
+		Time:      d.time(),
+		ExpiresAt: d.time(),
+		Seq:       d.uint(),
+		ID:        d.string(),
+		Account:   d.string(),
+		Volume:    d.decimal(),
+		Price:     d.decimal(),
+		Kind:      Kind(d.uint()),
+		Hidden:    d.bool(),
+	}
+}
@@ -0,0 +1,208 @@
+package market
+
+import (
+	"errors"
+)
+
+// DarkOrder is an order resting in a DarkPool
+type DarkOrder struct {
+	*Order
+	MinVolume Decimal // smallest volume accepted by a single execution
+}
+
+// minVolume is the minimum execution size, capped to what is left of the order
+func (o *DarkOrder) minVolume() Decimal {
+	return decimalMin(o.MinVolume, o.Volume)
+}
+
+// DarkFill is an execution inside a DarkPool
+type DarkFill struct {
+	BuyOrderID  string
+	SellOrderID string
+	Price       Decimal
+	Volume      Decimal
+}
+
+// DarkPool is a non-displayed book next to a lit Market.
+// Orders rest with a limit price, but they only execute at the midpoint of the lit market best bid and ask and only
+// for at least their minimum volume. Dark orders never show up in the lit Depth. The pool matches again every time the
+// lit midpoint moves, reporting executions to the fill callback.
+type DarkPool struct {
+	lit      *Market
+	buys     []*DarkOrder // by limit price, then time
+	sales    []*DarkOrder // by limit price, then time
+	midpoint Decimal
+	onFill   func(DarkFill)
+}
+
+func NewDarkPool(lit *Market, onFill func(DarkFill)) *DarkPool {
+	result := &DarkPool{
+		lit:      lit,
+		midpoint: NewZeroDecimal(),
+		onFill:   onFill,
+	}
+	lit.watch(result.litChanged)
+	return result
+}
+
+// Midpoint returns the middle of the lit best bid and ask, if both sides have displayed orders
+func (p *DarkPool) Midpoint() (Decimal, bool) {
+	var bid, ask *OrderQueue
+	p.lit.walk(Buy, func(level *OrderQueue) bool { bid = level; return false })
+	p.lit.walk(Sell, func(level *OrderQueue) bool { ask = level; return false })
+	if bid == nil || ask == nil {
+		return NewZeroDecimal(), false
+	}
+
+	return bid.Price.Add(ask.Price).Div(NewDecimalValue(2)), true
+}
+
+func (p *DarkPool) Order(orderID string) *DarkOrder {
+	for _, orders := range [][]*DarkOrder{p.buys, p.sales} {
+		for _, order := range orders {
+			if order.ID == orderID {
+				return order
+			}
+		}
+	}
+
+	return nil
+}
+
+// ProcessBuyOrder places a buy order in the pool and matches it at the current midpoint
+//
+//	orderID - unique order ID
+//	volume - how much volume you want to buy
+//	price  - no more expensive this price
+//	minVolume - no execution below this volume
+func (p *DarkPool) ProcessBuyOrder(orderID string, volume, price, minVolume Decimal) ([]DarkFill, error) {
+	return p.process(&DarkOrder{Order: NewBuy(orderID, volume, price, p.lit.now()), MinVolume: minVolume})
+}
+
+// ProcessSellOrder places a sell order in the pool and matches it at the current midpoint
+//
+//	orderID - unique order ID
+//	volume - how much volume you want to sell
+//	price - no less cheap than this price
+//	minVolume - no execution below this volume
+func (p *DarkPool) ProcessSellOrder(orderID string, volume, price, minVolume Decimal) ([]DarkFill, error) {
+	return p.process(&DarkOrder{Order: NewSell(orderID, volume, price, p.lit.now()), MinVolume: minVolume})
+}
+
+func (p *DarkPool) process(order *DarkOrder) ([]DarkFill, error) {
+	if p.Order(order.ID) != nil {
+		return nil, errors.New("order already exists")
+	}
+
+	if order.Volume.Sign() <= 0 {
+		return nil, errors.New("invalid order volume")
+	}
+
+	if order.Price.Sign() <= 0 {
+		return nil, errors.New("invalid order price")
+	}
+
+	if order.MinVolume.Sign() < 0 || order.MinVolume.GreaterThan(order.Volume) {
+		return nil, errors.New("invalid order minimum volume")
+	}
+
+	if order.Kind == Buy {
+		p.buys = insertDark(p.buys, order, func(a, b Decimal) bool { return a.GreaterThan(b) })
+	} else {
+		p.sales = insertDark(p.sales, order, func(a, b Decimal) bool { return a.LessThan(b) })
+	}
+
+	return p.match(), nil
+}
+
+// insertDark keeps orders sorted by price and, at equal prices, by arrival
+func insertDark(orders []*DarkOrder, order *DarkOrder, better func(a, b Decimal) bool) []*DarkOrder {
+	at := len(orders)
+	for i, resting := range orders {
+		if better(order.Price, resting.Price) {
+			at = i
+			break
+		}
+	}
+
+	orders = append(orders, nil)
+	copy(orders[at+1:], orders[at:])
+	orders[at] = order
+	return orders
+}
+
+func (p *DarkPool) CancelOrder(orderID string) *DarkOrder {
+	for i, order := range p.buys {
+		if order.ID == orderID {
+			p.buys = append(p.buys[:i], p.buys[i+1:]...)
+			return order
+		}
+	}
+
+	for i, order := range p.sales {
+		if order.ID == orderID {
+			p.sales = append(p.sales[:i], p.sales[i+1:]...)
+			return order
+		}
+	}
+
+	return nil
+}
+
+func (p *DarkPool) litChanged() {
+	midpoint, ok := p.Midpoint()
+	if !ok || midpoint.Equal(p.midpoint) {
+		return
+	}
+
+	for _, fill := range p.match() {
+		if p.onFill != nil {
+			p.onFill(fill)
+		}
+	}
+}
+
+// match crosses every buy willing to pay the midpoint with every sell willing to take it, in priority order
+func (p *DarkPool) match() []DarkFill {
+	midpoint, ok := p.Midpoint()
+	if !ok {
+		return nil
+	}
+	p.midpoint = midpoint
+
+	var result []DarkFill
+	for _, buy := range p.buys {
+		if buy.Price.LessThan(midpoint) {
+			break
+		}
+
+		for _, sale := range p.sales {
+			if sale.Price.GreaterThan(midpoint) || buy.Volume.Sign() <= 0 {
+				break
+			}
+
+			volume := decimalMin(buy.Volume, sale.Volume)
+			if sale.Volume.Sign() <= 0 || volume.LessThan(buy.minVolume()) || volume.LessThan(sale.minVolume()) {
+				continue
+			}
+
+			buy.Volume = buy.Volume.Sub(volume)
+			sale.Volume = sale.Volume.Sub(volume)
+			result = append(result, DarkFill{BuyOrderID: buy.ID, SellOrderID: sale.ID, Price: midpoint, Volume: volume})
+		}
+	}
+
+	p.buys = removeDone(p.buys)
+	p.sales = removeDone(p.sales)
+	return result
+}
+
+func removeDone(orders []*DarkOrder) []*DarkOrder {
+	result := orders[:0]
+	for _, order := range orders {
+		if order.Volume.Sign() > 0 {
+			result = append(result, order)
+		}
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+package market
+
+import (
+	"testing"
+)
+
+func TestDarkPool(t *testing.T) {
+	lit := NewMarket()
+	var fills []DarkFill
+	pool := NewDarkPool(lit, func(fill DarkFill) { fills = append(fills, fill) })
+
+	if _, ok := pool.Midpoint(); ok {
+		t.Fatal("empty lit market should not have a midpoint")
+	}
+
+	done, err := pool.ProcessBuyOrder("dark-buy", NewDecimalValue(10), NewDecimalValue(105), NewDecimalValue(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 0 {
+		t.Fatal("nothing should match without a lit midpoint")
+	}
+
+	if _, err := pool.ProcessSellOrder("dark-sell-small", NewDecimalValue(3), NewDecimalValue(90), NewDecimalValue(0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.ProcessSellOrder("dark-buy", NewDecimalValue(3), NewDecimalValue(90), NewDecimalValue(0)); err == nil {
+		t.Fatal("should not be possible to add an existing order")
+	}
+
+	if _, _, _, err := lit.ProcessBuyOrder("lit-buy", NewDecimalValue(1), NewDecimalValue(98)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := lit.ProcessSellOrder("lit-sell", NewDecimalValue(1), NewDecimalValue(102)); err != nil {
+		t.Fatal(err)
+	}
+
+	midpoint, ok := pool.Midpoint()
+	if !ok || !midpoint.Equal(NewDecimalValue(100)) {
+		t.Fatal("invalid midpoint", midpoint)
+	}
+
+	// the buy accepts no less than 4 pcs, so the small sell can't execute
+	if len(fills) != 0 {
+		t.Fatal("minimum volume should prevent execution", fills)
+	}
+
+	done, err = pool.ProcessSellOrder("dark-sell", NewDecimalValue(20), NewDecimalValue(95), NewDecimalValue(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].BuyOrderID != "dark-buy" || !done[0].Volume.Equal(NewDecimalValue(10)) || !done[0].Price.Equal(NewDecimalValue(100)) {
+		t.Fatal("invalid dark fill", done)
+	}
+
+	sales, buys := lit.Depth()
+	if len(sales) != 1 || len(buys) != 1 || !sales[0].Volume.Equal(NewDecimalValue(1)) {
+		t.Fatal("dark orders should not be displayed")
+	}
+
+	if _, err := pool.ProcessBuyOrder("dark-buy-2", NewDecimalValue(5), NewDecimalValue(99), NewDecimalValue(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// moving the lit midpoint to 98.5 makes the pool match again
+	lit.CancelOrder("lit-sell")
+	if _, _, _, err := lit.ProcessSellOrder("lit-sell-2", NewDecimalValue(1), NewDecimalValue(99)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fills) != 2 || fills[0].SellOrderID != "dark-sell-small" || !fills[0].Volume.Equal(NewDecimalValue(3)) ||
+		fills[1].SellOrderID != "dark-sell" || !fills[1].Volume.Equal(NewDecimalValue(2)) || !fills[1].Price.Equal(NewDecimalValue(985).Div(NewDecimalValue(10))) {
+		t.Fatal("pool should match when the midpoint moves", fills)
+	}
+
+	if pool.Order("dark-buy-2") != nil || pool.Order("dark-sell-small") != nil {
+		t.Fatal("filled dark orders should leave the pool")
+	}
+
+	if !pool.Order("dark-sell").Volume.Equal(NewDecimalValue(8)) {
+		t.Fatal("invalid dark order volume left")
+	}
+
+	if pool.CancelOrder("dark-sell") == nil || pool.Order("dark-sell") != nil {
+		t.Fatal("should be possible to cancel a dark order")
+	}
+}
+
+func TestDarkPoolMidpointDisplayed(t *testing.T) {
+	lit := NewMarket()
+	pool := NewDarkPool(lit, nil)
+
+	for _, order := range []*Order{
+		{ID: "bid", Kind: Buy, Volume: NewDecimalValue(1), Price: NewDecimalValue(90)},
+		{ID: "hidden-ask", Kind: Sell, Volume: NewDecimalValue(1), Price: NewDecimalValue(101), Hidden: true},
+		{ID: "ask", Kind: Sell, Volume: NewDecimalValue(1), Price: NewDecimalValue(110)},
+	} {
+		if _, _, _, err := lit.ProcessOrder(order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a level holding only hidden orders is not part of the lit quote
+	if midpoint, ok := pool.Midpoint(); !ok || !midpoint.Equal(NewDecimalValue(100)) {
+		t.Fatal("invalid midpoint", midpoint)
+	}
+}
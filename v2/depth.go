@@ -0,0 +1,88 @@
+package market
+
+import (
+	"errors"
+)
+
+// DepthLevel is a displayed price level, or a bucket of levels, along with the volume of the side up to it
+type DepthLevel struct {
+	PriceLevel
+	Cumulative Decimal
+}
+
+// walk visits the price levels holding displayed orders of a side, best price first, until fn returns false.
+// Each step costs O(log M) for the M price levels of the side.
+func (m *Market) walk(kind Kind, fn func(level *OrderQueue) bool) {
+	broker := m.broker(kind)
+
+	next := broker.LessThan
+	level := broker.MaxPriceQueue()
+	if kind == Sell {
+		next = broker.GreaterThan
+		level = broker.MinPriceQueue()
+	}
+
+	for ; level != nil; level = next(level.Price) {
+		if level.Displayed() == 0 {
+			continue
+		}
+
+		if !fn(level) {
+			return
+		}
+	}
+}
+
+// DepthTop returns at most limit displayed levels of each side, sales then buys like Depth, best price first, with
+// their order count and the cumulative volume. A limit of zero or less returns every level.
+func (m *Market) DepthTop(limit int) ([]DepthLevel, []DepthLevel) {
+	top := func(kind Kind) []DepthLevel {
+		var result []DepthLevel
+		cumulative := NewZeroDecimal()
+		m.walk(kind, func(level *OrderQueue) bool {
+			cumulative = cumulative.Add(level.Volume)
+			result = append(result, DepthLevel{PriceLevel: levelOf(level), Cumulative: cumulative})
+			return limit <= 0 || len(result) < limit
+		})
+		return result
+	}
+
+	return top(Sell), top(Buy)
+}
+
+// DepthAggregated returns at most limit buckets of each side, sales then buys, as DepthTop does for levels.
+// Buckets are step wide : bids are rounded down to a multiple of step and asks up, so a bucket never looks better than
+// the levels in it.
+func (m *Market) DepthAggregated(limit int, step Decimal) ([]DepthLevel, []DepthLevel, error) {
+	if step.Sign() <= 0 {
+		return nil, nil, errors.New("invalid bucket size")
+	}
+
+	aggregate := func(kind Kind) []DepthLevel {
+		var result []DepthLevel
+		cumulative := NewZeroDecimal()
+		m.walk(kind, func(level *OrderQueue) bool {
+			price := level.Price.Div(step).Floor().Mul(step)
+			if kind == Sell {
+				price = level.Price.Div(step).Ceil().Mul(step)
+			}
+
+			if len(result) == 0 || !result[len(result)-1].Price.Equal(price) {
+				if limit > 0 && len(result) == limit {
+					return false
+				}
+				result = append(result, DepthLevel{PriceLevel: PriceLevel{Price: price, Volume: NewZeroDecimal()}})
+			}
+
+			cumulative = cumulative.Add(level.Volume)
+			bucket := &result[len(result)-1]
+			bucket.Volume = bucket.Volume.Add(level.Volume)
+			bucket.Orders += level.Displayed()
+			bucket.Cumulative = cumulative
+			return true
+		})
+		return result
+	}
+
+	return aggregate(Sell), aggregate(Buy), nil
+}
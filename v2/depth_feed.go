@@ -0,0 +1,180 @@
+package market
+
+import (
+	"errors"
+)
+
+// PriceLevel is a price level of the market-by-price feed : displayed volume and number of displayed orders.
+// Hidden orders are not part of it.
+type PriceLevel struct {
+	Price  Decimal
+	Volume Decimal
+	Orders int
+}
+
+// LevelUpdate is the new state of a price level. A level with no orders left is removed from the book.
+// Seq numbers the updates of a DepthFeed without gaps.
+type LevelUpdate struct {
+	Seq    uint64
+	Kind   Kind
+	Price  Decimal
+	Volume Decimal
+	Orders int
+}
+
+// DepthSnapshot is the full L2 book, best prices first, as of the update Seq
+type DepthSnapshot struct {
+	Seq  uint64
+	Bids []PriceLevel
+	Asks []PriceLevel
+}
+
+// Apply changes the snapshot with an update. Updates already part of the snapshot are ignored, a missing update is
+// an error since the snapshot can't be trusted anymore.
+func (s *DepthSnapshot) Apply(update LevelUpdate) error {
+	if update.Seq <= s.Seq {
+		return nil
+	}
+
+	if update.Seq != s.Seq+1 {
+		return errors.New("depth feed sequence gap")
+	}
+	s.Seq = update.Seq
+
+	levels, better := &s.Asks, func(a, b Decimal) bool { return a.LessThan(b) }
+	if update.Kind == Buy {
+		levels, better = &s.Bids, func(a, b Decimal) bool { return a.GreaterThan(b) }
+	}
+
+	at := len(*levels)
+	for i, level := range *levels {
+		if !better(level.Price, update.Price) {
+			at = i
+			break
+		}
+	}
+
+	exists := at < len(*levels) && (*levels)[at].Price.Equal(update.Price)
+	switch {
+	case update.Orders == 0 && exists:
+		*levels = append((*levels)[:at], (*levels)[at+1:]...)
+	case update.Orders == 0:
+	case exists:
+		(*levels)[at] = PriceLevel{Price: update.Price, Volume: update.Volume, Orders: update.Orders}
+	default:
+		*levels = append(*levels, PriceLevel{})
+		copy((*levels)[at+1:], (*levels)[at:])
+		(*levels)[at] = PriceLevel{Price: update.Price, Volume: update.Volume, Orders: update.Orders}
+	}
+
+	return nil
+}
+
+// DepthFeed is the incremental L2 (market-by-price) feed of a Market. It publishes a LevelUpdate every time the
+// displayed volume or order count of a price level changes, without walking the book. Consumers start from Snapshot
+// and apply the updates that follow it.
+type DepthFeed struct {
+	market   *Market
+	levels   map[Kind]map[string]PriceLevel // last published state
+	resting  map[string]Order               // orderID -> resting order, to find the level it left
+	seq      uint64
+	onUpdate func(LevelUpdate)
+}
+
+func NewDepthFeed(market *Market, onUpdate func(LevelUpdate)) *DepthFeed {
+	result := &DepthFeed{
+		market:   market,
+		levels:   map[Kind]map[string]PriceLevel{Buy: {}, Sell: {}},
+		resting:  map[string]Order{},
+		onUpdate: onUpdate,
+	}
+
+	for _, broker := range []*Broker{market.buys, market.sales} {
+		for _, level := range broker.prices {
+			for e := level.Head(); e != nil; e = level.Next(e) {
+				result.resting[e.Order.ID] = *e.Order
+			}
+			if level.Displayed() > 0 {
+				result.levels[level.Head().Order.Kind][level.Price.String()] = levelOf(level)
+			}
+		}
+	}
+
+	market.listen(result)
+	return result
+}
+
+func levelOf(queue *OrderQueue) PriceLevel {
+	return PriceLevel{Price: queue.Price, Volume: queue.Volume, Orders: queue.Displayed()}
+}
+
+// Seq returns the sequence number of the last update
+func (f *DepthFeed) Seq() uint64 {
+	return f.seq
+}
+
+// Snapshot returns the current book, tagged with the sequence number of the last update
+func (f *DepthFeed) Snapshot() DepthSnapshot {
+	result := DepthSnapshot{Seq: f.seq}
+
+	f.market.walk(Buy, func(level *OrderQueue) bool {
+		result.Bids = append(result.Bids, levelOf(level))
+		return true
+	})
+
+	f.market.walk(Sell, func(level *OrderQueue) bool {
+		result.Asks = append(result.Asks, levelOf(level))
+		return true
+	})
+
+	return result
+}
+
+// OnEvent checks the levels an event may have changed : the one the order rested at before and the one of the order
+// now
+func (f *DepthFeed) OnEvent(event Event) {
+	id := event.Order.ID
+	previous, wasResting := f.resting[id]
+
+	if e, ok := f.market.orders[id]; ok {
+		f.resting[id] = *e.Order
+	} else {
+		delete(f.resting, id)
+	}
+
+	if wasResting {
+		f.check(previous.Kind, previous.Price)
+	}
+
+	if !wasResting || !previous.Price.Equal(event.Order.Price) || previous.Kind != event.Order.Kind {
+		f.check(event.Order.Kind, event.Order.Price)
+	}
+}
+
+// check publishes the state of a price level if it differs from the last one published
+func (f *DepthFeed) check(kind Kind, price Decimal) {
+	key := price.String()
+	last, known := f.levels[kind][key]
+
+	current := PriceLevel{Price: price, Volume: NewZeroDecimal()}
+	if queue := f.market.broker(kind).Level(price); queue != nil && queue.Displayed() > 0 {
+		current = levelOf(queue)
+	}
+
+	if current.Orders == 0 {
+		if !known {
+			return
+		}
+		delete(f.levels[kind], key)
+	} else {
+		if known && last.Orders == current.Orders && last.Volume.Equal(current.Volume) {
+			return
+		}
+		f.levels[kind][key] = current
+	}
+
+	f.seq++
+	if f.onUpdate != nil {
+		f.onUpdate(LevelUpdate{Seq: f.seq, Kind: kind, Price: current.Price, Volume: current.Volume, Orders: current.Orders})
+	}
+}
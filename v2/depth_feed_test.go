@@ -0,0 +1,103 @@
+package market
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDepthFeed(t *testing.T) {
+	market := NewMarket()
+
+	// orders resting before the feed starts are part of the first snapshot
+	if _, _, _, err := market.ProcessSellOrder("sell-early", NewDecimalValue(5), NewDecimalValue(110)); err != nil {
+		t.Fatal(err)
+	}
+
+	var updates []LevelUpdate
+	feed := NewDepthFeed(market, func(update LevelUpdate) { updates = append(updates, update) })
+	snapshot := feed.Snapshot()
+	if snapshot.Seq != 0 || len(snapshot.Asks) != 1 || snapshot.Asks[0].Orders != 1 {
+		t.Fatal("invalid first snapshot", snapshot)
+	}
+
+	steps := []func() error{
+		func() error {
+			_, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(2), NewDecimalValue(100))
+			return err
+		},
+		func() error {
+			_, _, _, err := market.ProcessSellOrder("sell-2", NewDecimalValue(3), NewDecimalValue(100))
+			return err
+		},
+		func() error {
+			_, _, _, err := market.ProcessOrder(&Order{ID: "sell-hidden", Kind: Sell, Volume: NewDecimalValue(4), Price: NewDecimalValue(105), Hidden: true})
+			return err
+		},
+		func() error {
+			_, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(1), NewDecimalValue(95))
+			return err
+		},
+		func() error {
+			_, _, _, err := market.ProcessBuyOrder("buy-2", NewDecimalValue(3), NewDecimalValue(100))
+			return err
+		},
+		func() error {
+			_, err := market.AmendOrder("buy-1", NewDecimalValue(1), NewDecimalValue(96))
+			return err
+		},
+		func() error {
+			_, err := market.Quote("maker", Quote{BidPrice: NewDecimalValue(97), BidVolume: NewDecimalValue(10), AskPrice: NewDecimalValue(103), AskVolume: NewDecimalValue(10)})
+			return err
+		},
+		func() error {
+			_, err := market.Quote("maker", Quote{BidPrice: NewDecimalValue(98), BidVolume: NewDecimalValue(10), AskPrice: NewDecimalValue(103), AskVolume: NewDecimalValue(5)})
+			return err
+		},
+		func() error {
+			_, err := market.PlaceOrder(NewBuy("buy-3", NewDecimalValue(12), NewDecimalValue(110), time.Time{}))
+			return err
+		},
+		func() error {
+			market.CancelOrder("buy-1")
+			return nil
+		},
+		func() error {
+			_, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(1), NewDecimalValue(96))
+			return err
+		},
+	}
+
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, update := range updates {
+			if err := snapshot.Apply(update); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if expected := feed.Snapshot(); !reflect.DeepEqual(snapshot, expected) {
+			t.Fatalf("step %d : rebuilt book differs\n%v\n%v", i, snapshot, expected)
+		}
+	}
+
+	if snapshot.Seq != feed.Seq() || feed.Seq() != uint64(len(updates)) {
+		t.Fatal("invalid feed sequence", feed.Seq(), len(updates))
+	}
+
+	// the hidden order traded, but never changed the displayed levels
+	for _, update := range updates {
+		if update.Price.Equal(NewDecimalValue(105)) {
+			t.Fatal("hidden order should not be published", update)
+		}
+	}
+
+	// a snapshot can't skip updates
+	late := DepthSnapshot{Seq: 1}
+	if err := late.Apply(LevelUpdate{Seq: 3, Kind: Buy, Price: NewDecimalValue(1), Volume: NewDecimalValue(1), Orders: 1}); err == nil {
+		t.Fatal("sequence gap should be reported")
+	}
+}
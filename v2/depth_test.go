@@ -0,0 +1,71 @@
+package market
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestDepthQueries(t *testing.T) {
+	market := NewMarket()
+
+	orders := []struct {
+		kind          Kind
+		volume, price Decimal
+		hidden        bool
+	}{
+		{Buy, NewDecimalValue(1), decimal.RequireFromString("99.8"), false},
+		{Buy, NewDecimalValue(2), decimal.RequireFromString("99.6"), false},
+		{Buy, NewDecimalValue(3), decimal.RequireFromString("99.6"), false},
+		{Buy, NewDecimalValue(4), decimal.RequireFromString("99.9"), true},
+		{Buy, NewDecimalValue(5), decimal.RequireFromString("98.2"), false},
+		{Sell, NewDecimalValue(1), decimal.RequireFromString("100.1"), false},
+		{Sell, NewDecimalValue(2), decimal.RequireFromString("100.4"), false},
+		{Sell, NewDecimalValue(3), decimal.RequireFromString("101.5"), false},
+	}
+
+	for i, order := range orders {
+		id := "order-" + strconv.Itoa(i)
+		if _, _, _, err := market.ProcessOrder(&Order{ID: id, Kind: order.kind, Volume: order.volume, Price: order.price, Hidden: order.hidden}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	asks, bids := market.DepthTop(2)
+	if len(bids) != 2 || len(asks) != 2 {
+		t.Fatal("invalid levels count", bids, asks)
+	}
+	if !bids[0].Price.Equal(decimal.RequireFromString("99.8")) || !bids[1].Price.Equal(decimal.RequireFromString("99.6")) || bids[1].Orders != 2 ||
+		!bids[1].Volume.Equal(NewDecimalValue(5)) || !bids[1].Cumulative.Equal(NewDecimalValue(6)) {
+		t.Fatal("invalid bids, best first without the hidden order", bids)
+	}
+	if !asks[0].Price.Equal(decimal.RequireFromString("100.1")) || !asks[1].Cumulative.Equal(NewDecimalValue(3)) {
+		t.Fatal("invalid asks, best first", asks)
+	}
+
+	if asks, bids = market.DepthTop(0); len(bids) != 3 || len(asks) != 3 {
+		t.Fatal("every level should be returned", bids, asks)
+	}
+
+	if _, _, err := market.DepthAggregated(5, NewZeroDecimal()); err == nil {
+		t.Fatal("should not be possible to aggregate by empty buckets")
+	}
+
+	asks, bids, err := market.DepthAggregated(2, NewDecimalValue(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bids) != 2 || !bids[0].Price.Equal(NewDecimalValue(99)) || !bids[0].Volume.Equal(NewDecimalValue(6)) || bids[0].Orders != 3 ||
+		!bids[1].Price.Equal(NewDecimalValue(98)) || !bids[1].Cumulative.Equal(NewDecimalValue(11)) {
+		t.Fatal("invalid aggregated bids", bids)
+	}
+	if len(asks) != 2 || !asks[0].Price.Equal(NewDecimalValue(101)) || !asks[0].Volume.Equal(NewDecimalValue(3)) ||
+		!asks[1].Price.Equal(NewDecimalValue(102)) || !asks[1].Cumulative.Equal(NewDecimalValue(6)) {
+		t.Fatal("invalid aggregated asks", asks)
+	}
+
+	if _, bids, _ = market.DepthAggregated(1, decimal.RequireFromString("0.5")); len(bids) != 1 || !bids[0].Price.Equal(decimal.RequireFromString("99.5")) {
+		t.Fatal("invalid half wide buckets", bids)
+	}
+}
@@ -0,0 +1,318 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DropCopyMessage is an execution or an order state change of an account. Seq numbers the messages of the drop copy
+// without gaps, EventSeq is the sequence number of the event in the market named Symbol. A trade makes a message for
+// each side, both holding the Trade : Order is the state of the account's order after the event.
+type DropCopyMessage struct {
+	Seq      uint64
+	Symbol   string
+	EventSeq uint64
+	Time     time.Time
+	Type     EventType
+	Account  string
+	Order    Order
+	Trade    *Trade
+	Reason   string
+}
+
+func (msg *DropCopyMessage) encode(e *encoder) {
+	e.uint(msg.Seq)
+	e.string(msg.Symbol)
+	e.uint(msg.EventSeq)
+	e.time(msg.Time)
+	e.uint(uint64(msg.Type))
+	e.string(msg.Account)
+	e.order(&msg.Order)
+	e.bool(msg.Trade != nil)
+	if trade := msg.Trade; trade != nil {
+		e.time(trade.Time)
+		e.uint(trade.ID)
+		e.string(trade.MakerOrderID)
+		e.string(trade.TakerOrderID)
+		e.decimal(trade.Price)
+		e.decimal(trade.Volume)
+		e.uint(uint64(trade.Aggressor))
+	}
+	e.string(msg.Reason)
+}
+
+func (msg *DropCopyMessage) decode(d *decoder) {
+	msg.Seq = d.uint()
+	msg.Symbol = d.string()
+	msg.EventSeq = d.uint()
+	msg.Time = d.time()
+	msg.Type = EventType(d.uint())
+	msg.Account = d.string()
+	msg.Order = *d.order()
+	if d.bool() {
+		msg.Trade = &Trade{Time: d.time(), ID: d.uint(), MakerOrderID: d.string(), TakerOrderID: d.string(), Price: d.decimal(),
+			Volume: d.decimal(), Aggressor: Kind(d.uint())}
+	}
+	msg.Reason = d.string()
+}
+
+// DropCopy is a Listener keeping every execution and order state change of a market in a log file, the event journal
+// of the drop copy, so subscribers get the messages of their accounts from any sequence number and reconnect without
+// losing fills. The markets of an exchange share one through the listeners returned by Listener. Each message is
+// synced before the market goes on. Events already logged, such as the ones of a market recovered from its journal,
+// are skipped. Once a write fails the drop copy stops, Err tells why.
+type DropCopy struct {
+	incoming incoming
+
+	mu        sync.Mutex
+	file      *os.File
+	size      int64             // of the valid records
+	seq       uint64            // of the last message
+	eventSeqs map[string]uint64 // symbol -> last event logged
+	err       error
+	changed   chan struct{} // closed when messages are added or the drop copy closes
+	closed    bool
+}
+
+// OpenDropCopy opens the log file of a drop copy at path, creating it if needed. A torn last record is truncated.
+func OpenDropCopy(path string) (*DropCopy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	result := &DropCopy{eventSeqs: map[string]uint64{}, changed: make(chan struct{})}
+	valid, err := scanRecords(data, func(payload []byte) error {
+		var msg DropCopyMessage
+		d := decoder{buf: payload}
+		msg.decode(&d)
+		result.seq, result.eventSeqs[msg.Symbol] = msg.Seq, msg.EventSeq
+		return d.err
+	})
+	if err != nil && !errors.Is(err, errTornRecord) {
+		return nil, err
+	}
+
+	result.file, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := result.file.Truncate(int64(valid)); err != nil {
+		result.file.Close()
+		return nil, err
+	}
+
+	result.size = int64(valid)
+	return result, nil
+}
+
+// Seq returns the sequence number of the last message
+func (d *DropCopy) Seq() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.seq
+}
+
+// Err returns the write error which stopped the drop copy, if any
+func (d *DropCopy) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.err
+}
+
+// OnEvent logs the events of a single market, with no symbol
+func (d *DropCopy) OnEvent(event Event) {
+	d.log("", d.incoming.track(event), event)
+}
+
+// Listener returns the listener logging the events of the market named symbol. Each market sharing the drop copy
+// needs its own, so their sequence numbers and incoming orders are told apart.
+func (d *DropCopy) Listener(symbol string) Listener {
+	return &dropCopyListener{dropCopy: d, symbol: symbol}
+}
+
+// dropCopyListener follows the incoming orders of a market of a drop copy
+type dropCopyListener struct {
+	dropCopy *DropCopy
+	symbol   string
+	incoming incoming
+}
+
+func (l *dropCopyListener) OnEvent(event Event) {
+	l.dropCopy.log(l.symbol, l.incoming.track(event), event)
+}
+
+// log writes the messages of event of the market named symbol, taker being the incoming order after a trade
+func (d *DropCopy) log(symbol string, taker *Order, event Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil || d.closed || event.Seq <= d.eventSeqs[symbol] {
+		return
+	}
+
+	messages := []DropCopyMessage{{Symbol: symbol, EventSeq: event.Seq, Time: event.Time, Type: event.Type,
+		Account: event.Order.Account, Order: event.Order, Trade: event.Trade, Reason: event.Reason}}
+	if taker != nil {
+		messages = append(messages, DropCopyMessage{Symbol: symbol, EventSeq: event.Seq, Time: event.Time, Type: event.Type,
+			Account: taker.Account, Order: *taker, Trade: event.Trade})
+	}
+
+	var e encoder
+	for i := range messages {
+		messages[i].Seq = d.seq + uint64(i) + 1
+
+		start := len(e.buf)
+		e.buf = append(e.buf, make([]byte, recordHeader)...)
+		messages[i].encode(&e)
+		seal(e.buf[start:])
+	}
+
+	if _, err := d.file.WriteAt(e.buf, d.size); err != nil {
+		d.err = err
+		return
+	}
+
+	if err := d.file.Sync(); err != nil {
+		d.err = err
+		return
+	}
+
+	d.size += int64(len(e.buf))
+	d.seq += uint64(len(messages))
+	d.eventSeqs[symbol] = event.Seq
+	d.broadcast()
+}
+
+// broadcast wakes the waiting subscribers up. The caller holds mu.
+func (d *DropCopy) broadcast() {
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// Close closes the log file, ending the subscriptions once they read every message
+func (d *DropCopy) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil
+	}
+
+	d.closed = true
+	d.broadcast()
+	return d.file.Close()
+}
+
+// Subscription reads the messages of a drop copy for some accounts, in sequence order
+type Subscription struct {
+	dropCopy *DropCopy
+	accounts map[string]bool
+	from     uint64
+	offset   int64
+	file     *os.File
+}
+
+// Subscribe returns the messages of the accounts, or of every account if none is given, after the message from.
+// A consumer reconnecting subscribes from the last message it handled.
+func (d *DropCopy) Subscribe(from uint64, accounts ...string) (*Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, errors.New("drop copy is closed")
+	}
+
+	// subscriptions read on their own, so closing the drop copy doesn't break a read
+	file, err := os.Open(d.file.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Subscription{dropCopy: d, from: from, file: file}
+	if len(accounts) > 0 {
+		result.accounts = map[string]bool{}
+		for _, account := range accounts {
+			result.accounts[account] = true
+		}
+	}
+
+	return result, nil
+}
+
+// Next returns the next message of the subscription, waiting for it if needed. Once the drop copy is closed and every
+// message read, the error is io.EOF.
+func (s *Subscription) Next(ctx context.Context) (DropCopyMessage, error) {
+	for {
+		d := s.dropCopy
+		d.mu.Lock()
+		size, changed, closed := d.size, d.changed, d.closed
+		d.mu.Unlock()
+
+		for s.offset < size {
+			msg, err := s.read()
+			if err != nil {
+				return DropCopyMessage{}, err
+			}
+
+			if msg.Seq > s.from && (s.accounts == nil || s.accounts[msg.Account]) {
+				s.from = msg.Seq
+				return msg, nil
+			}
+		}
+
+		if closed {
+			return DropCopyMessage{}, io.EOF
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return DropCopyMessage{}, ctx.Err()
+		}
+	}
+}
+
+// read reads the message at the offset of the subscription, which must be before the size of the valid records
+func (s *Subscription) read() (DropCopyMessage, error) {
+	header := make([]byte, recordHeader)
+	if _, err := s.file.ReadAt(header, s.offset); err != nil {
+		return DropCopyMessage{}, err
+	}
+
+	size, err := recordSize(header)
+	if err != nil {
+		return DropCopyMessage{}, errCorrupted
+	}
+
+	payload := make([]byte, size)
+	if _, err := s.file.ReadAt(payload, s.offset+recordHeader); err != nil {
+		return DropCopyMessage{}, err
+	}
+
+	if !checkPayload(header, payload) {
+		return DropCopyMessage{}, errCorrupted
+	}
+
+	var msg DropCopyMessage
+	d := decoder{buf: payload}
+	msg.decode(&d)
+	if d.err != nil {
+		return DropCopyMessage{}, d.err
+	}
+
+	s.offset += recordHeader + int64(len(payload))
+	return msg, nil
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() error {
+	return s.file.Close()
+}
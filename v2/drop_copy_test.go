@@ -0,0 +1,190 @@
+package market
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDropCopy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drop-copy.log")
+	dropCopy, err := OpenDropCopy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []Event
+	market := NewMarket(WithListener(dropCopy), WithListener(ListenerFunc(func(event Event) { events = append(events, event) })))
+	if _, err := market.PlaceOrder(&Order{ID: "sell-1", Account: "alice", Kind: Sell, Volume: NewDecimalValue(5), Price: NewDecimalValue(101)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := market.PlaceOrder(&Order{ID: "buy-1", Account: "bob", Kind: Buy, Volume: NewDecimalValue(3), Price: NewDecimalValue(101)}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	next := func(subscription *Subscription, expected EventType, seq uint64) DropCopyMessage {
+		t.Helper()
+
+		msg, err := subscription.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != expected || msg.Seq != seq {
+			t.Fatalf("invalid drop copy message %+v", msg)
+		}
+		return msg
+	}
+
+	alice, err := dropCopy.Subscribe(0, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+
+	next(alice, Accepted, 1)
+	next(alice, Rested, 2)
+	if fill := next(alice, Traded, 4); !fill.Order.Volume.Equal(NewDecimalValue(2)) || fill.Trade == nil || !fill.Trade.Volume.Equal(NewDecimalValue(3)) {
+		t.Fatalf("invalid maker fill %+v", fill)
+	}
+
+	bob, err := dropCopy.Subscribe(0, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next(bob, Accepted, 3)
+	if fill := next(bob, Traded, 5); fill.Order.ID != "buy-1" || !fill.Order.Volume.IsZero() || fill.Trade.MakerOrderID != "sell-1" {
+		t.Fatalf("invalid taker fill %+v", fill)
+	}
+
+	// live messages wake the subscriber up
+	received := make(chan DropCopyMessage, 1)
+	go func() {
+		msg, _ := bob.Next(ctx)
+		received <- msg
+	}()
+	if _, err := market.PlaceOrder(&Order{ID: "buy-2", Account: "bob", Kind: Buy, Volume: NewDecimalValue(1), Price: NewDecimalValue(100)}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-received; msg.Seq != 6 || msg.Type != Accepted || msg.Order.ID != "buy-2" {
+		t.Fatalf("invalid live message %+v", msg)
+	}
+	bob.Close()
+
+	// events of a market replaying its journal are logged once
+	for _, event := range events {
+		dropCopy.OnEvent(event)
+	}
+	if dropCopy.Seq() != 7 {
+		t.Fatal("invalid drop copy sequence", dropCopy.Seq())
+	}
+
+	if err := dropCopy.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Next(ctx); err != io.EOF {
+		t.Fatal("closed drop copy should end the subscription", err)
+	}
+
+	// a crash tears the last record, bob reconnects after the last message handled
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{0, 0, 0, 40, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	dropCopy, err = OpenDropCopy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dropCopy.Close()
+
+	if dropCopy.Seq() != 7 {
+		t.Fatal("invalid reopened drop copy sequence", dropCopy.Seq())
+	}
+
+	bob, err = dropCopy.Subscribe(6, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+
+	if msg := next(bob, Rested, 7); msg.Order.ID != "buy-2" {
+		t.Fatalf("invalid replayed message %+v", msg)
+	}
+}
+
+func TestDropCopyMarkets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drop-copy.log")
+	dropCopy, err := OpenDropCopy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both markets number their events from one, the drop copy tells them apart by symbol
+	exchange := NewExchange()
+	var events []Event
+	for _, symbol := range []string{"BTC", "ETH"} {
+		options := []Option{WithListener(dropCopy.Listener(symbol))}
+		if symbol == "ETH" {
+			options = append(options, WithListener(ListenerFunc(func(event Event) { events = append(events, event) })))
+		}
+
+		market, err := exchange.AddMarket(symbol, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := market.PlaceOrder(&Order{ID: symbol + "-sell", Account: "alice", Kind: Sell, Volume: NewDecimalValue(1), Price: NewDecimalValue(100)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dropCopy.Seq() != 4 {
+		t.Fatal("events of every market should be logged", dropCopy.Seq())
+	}
+	if err := dropCopy.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reopened drop copy still skips what it logged of each market
+	dropCopy, err = OpenDropCopy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dropCopy.Close()
+
+	listener := dropCopy.Listener("ETH")
+	for _, event := range events {
+		listener.OnEvent(event)
+	}
+	if dropCopy.Seq() != 4 {
+		t.Fatal("logged events should be skipped", dropCopy.Seq())
+	}
+
+	subscription, err := dropCopy.Subscribe(0, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscription.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, expected := range []string{"BTC", "BTC", "ETH", "ETH"} {
+		msg, err := subscription.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Symbol != expected || msg.Order.ID != expected+"-sell" {
+			t.Fatalf("invalid message %+v", msg)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package market
+
+import (
+	"sync"
+	"time"
+)
+
+type EventType int
+
+const (
+	Accepted  EventType = iota // order passed validation
+	Rejected                   // order failed validation, Reason tells why
+	Rested                     // order, or what is left of it, entered the book
+	Traded                     // resting order traded, Trade holds the match
+	Cancelled                  // resting order was cancelled
+	Amended                    // resting order changed volume or price
+	Expired                    // resting order reached its expiry time
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Accepted:
+		return "accepted"
+	case Rejected:
+		return "rejected"
+	case Rested:
+		return "rested"
+	case Traded:
+		return "traded"
+	case Cancelled:
+		return "cancelled"
+	case Amended:
+		return "amended"
+	case Expired:
+		return "expired"
+	default:
+		return "unknown event"
+	}
+}
+
+// Event is a change made by the Market. Order is a copy of the order state right after the change : for Traded
+// events that is the resting (maker) order with the volume it has left. A batch auction trades resting orders on both
+// sides, so its trades make a Traded event for the maker then one for the taker, sharing the Trade.
+// Seq numbers the events of the market without gaps, GlobalSeq does the same across an Exchange.
+type Event struct {
+	Time      time.Time
+	Seq       uint64
+	GlobalSeq uint64
+	Type      EventType
+	Order     Order
+	Trade     *Trade
+	Reason    string
+}
+
+// MakerTrade tells if event is the Traded event of the maker of its trade, the one counting the trade once
+func (e Event) MakerTrade() bool {
+	return e.Type == Traded && e.Order.ID == e.Trade.MakerOrderID
+}
+
+// Listener receives the events of a Market, synchronously and in the exact order they happen
+type Listener interface {
+	OnEvent(event Event)
+}
+
+// ListenerFunc is the synchronous callback adapter of Listener
+type ListenerFunc func(event Event)
+
+func (f ListenerFunc) OnEvent(event Event) {
+	f(event)
+}
+
+// ChannelListener is the buffered channel adapter of Listener. Once the buffer is full, the market waits for the
+// consumer.
+type ChannelListener struct {
+	events chan Event
+	once   sync.Once
+}
+
+func NewChannelListener(size int) *ChannelListener {
+	return &ChannelListener{events: make(chan Event, size)}
+}
+
+func (l *ChannelListener) OnEvent(event Event) {
+	l.events <- event
+}
+
+// Events returns the channel to consume events from
+func (l *ChannelListener) Events() <-chan Event {
+	return l.events
+}
+
+// Close closes the events channel. The market must not emit events afterwards.
+func (l *ChannelListener) Close() {
+	l.once.Do(func() { close(l.events) })
+}
+
+// WithListener adds a listener of the market events
+func WithListener(listener Listener) Option {
+	return func(m *Market) {
+		m.listeners = append(m.listeners, listener)
+	}
+}
+
+// emit sequences an event and hands it to the listeners. Once the market halted, nothing more happens.
+func (m *Market) emit(eventType EventType, order Order, trade *Trade, reason string) {
+	if m.halted {
+		return
+	}
+
+	m.seq++
+	event := Event{Time: m.now(), Seq: m.seq, Type: eventType, Order: order, Trade: trade, Reason: reason}
+	if m.globalSeq != nil {
+		event.GlobalSeq = m.globalSeq.Add(1)
+	}
+
+	for _, listener := range m.listeners {
+		listener.OnEvent(event)
+	}
+
+	m.halted = m.halt != 0 && m.seq == m.halt
+}
+
+// reject reports an order failing validation and returns err
+func (m *Market) reject(order *Order, err error) error {
+	m.emit(Rejected, *order, nil, err.Error())
+	return err
+}
+
+// incoming follows the incoming order through the events, as trades only tell the state of the resting order
+type incoming struct {
+	order *Order // with the volume left
+}
+
+// track follows event and returns the state of the incoming order after it, when event is a trade of that order
+func (t *incoming) track(event Event) *Order {
+	switch event.Type {
+	case Accepted, Amended:
+		// an amended order losing its priority comes in again and may trade
+		order := event.Order
+		t.order = &order
+	case Rested:
+		if t.order != nil && t.order.ID == event.Order.ID {
+			t.order = nil
+		}
+	case Traded:
+		if t.order == nil || t.order.ID != event.Trade.TakerOrderID {
+			return nil
+		}
+
+		t.order.Volume = t.order.Volume.Sub(event.Trade.Volume)
+		state := *t.order
+		if state.Volume.Sign() <= 0 {
+			t.order = nil
+		}
+		return &state
+	}
+
+	return nil
+}
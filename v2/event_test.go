@@ -0,0 +1,122 @@
+package market
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func eventTypes(events []Event) []EventType {
+	result := make([]EventType, len(events))
+	for i, event := range events {
+		result[i] = event.Type
+	}
+	return result
+}
+
+func TestEvents(t *testing.T) {
+	var events []Event
+	market := NewMarket(WithListener(ListenerFunc(func(event Event) { events = append(events, event) })))
+
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(2), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessSellOrder("sell-2", NewDecimalValue(2), NewDecimalValue(101)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(5), NewDecimalValue(101)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(5), NewDecimalValue(101)); err == nil {
+		t.Fatal("should not be possible to process existing order")
+	}
+
+	expected := []EventType{Accepted, Rested, Accepted, Rested, Accepted, Traded, Traded, Rested, Rejected}
+	if !reflect.DeepEqual(eventTypes(events), expected) {
+		t.Fatal("invalid events", eventTypes(events))
+	}
+
+	if events[5].Order.ID != "sell-1" || events[5].Order.Volume.Sign() != 0 || events[5].Trade.TakerOrderID != "buy-1" {
+		t.Fatal("traded event should describe the maker order", events[5])
+	}
+
+	if events[7].Order.ID != "buy-1" || !events[7].Order.Volume.Equal(NewDecimalValue(1)) {
+		t.Fatal("rested event should hold the volume left", events[7])
+	}
+
+	if events[8].Reason != "order already exists" {
+		t.Fatal("rejected event should tell why", events[8].Reason)
+	}
+
+	events = nil
+	if _, err := market.AmendOrder("buy-1", NewDecimalValue(3), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := market.AmendOrder("buy-1", NewDecimalValue(2), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := market.AmendOrder("unknown", NewDecimalValue(2), NewDecimalValue(100)); err == nil {
+		t.Fatal("should not be possible to amend unknown order")
+	}
+
+	expected = []EventType{Amended, Rested, Amended}
+	if !reflect.DeepEqual(eventTypes(events), expected) {
+		t.Fatal("invalid amend events", eventTypes(events))
+	}
+
+	if market.Order("buy-1") == nil || !market.Order("buy-1").Volume.Equal(NewDecimalValue(2)) || !market.Order("buy-1").Price.Equal(NewDecimalValue(100)) {
+		t.Fatal("order should be amended")
+	}
+
+	events = nil
+	now := time.Now().UTC()
+	expiring := NewSell("sell-3", NewDecimalValue(1), NewDecimalValue(110), time.Time{})
+	expiring.ExpiresAt = now
+	if _, _, _, err := market.ProcessOrder(expiring); err != nil {
+		t.Fatal(err)
+	}
+
+	if expired := market.ExpireOrders(now.Add(-time.Second)); len(expired) != 0 {
+		t.Fatal("order should not expire yet")
+	}
+
+	if expired := market.ExpireOrders(now); len(expired) != 1 || market.Order("sell-3") != nil {
+		t.Fatal("order should expire")
+	}
+
+	market.CancelOrder("buy-1")
+	market.CancelOrder("buy-1")
+
+	expected = []EventType{Accepted, Rested, Expired, Cancelled}
+	if !reflect.DeepEqual(eventTypes(events), expected) {
+		t.Fatal("invalid expire and cancel events", eventTypes(events))
+	}
+}
+
+func TestQuoteEvents(t *testing.T) {
+	listener := NewChannelListener(16)
+	market := NewMarket(WithListener(listener))
+
+	quote := Quote{BidPrice: NewDecimalValue(99), BidVolume: NewDecimalValue(10), AskPrice: NewDecimalValue(101), AskVolume: NewDecimalValue(10)}
+	if _, err := market.Quote("maker", quote); err != nil {
+		t.Fatal(err)
+	}
+
+	quote.BidPrice = NewDecimalValue(98)
+	quote.AskVolume = NewDecimalValue(5)
+	if _, err := market.Quote("maker", quote); err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+
+	var events []Event
+	for event := range listener.Events() {
+		events = append(events, event)
+	}
+
+	// the second quote moves the bid and reduces the ask : no cancel and no new order
+	expected := []EventType{Accepted, Rested, Accepted, Rested, Amended, Amended, Rested}
+	if !reflect.DeepEqual(eventTypes(events), expected) {
+		t.Fatal("invalid quote events", eventTypes(events))
+	}
+}
@@ -0,0 +1,84 @@
+package market
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Exchange holds the markets of several instruments, by symbol, and sequences their events globally
+type Exchange struct {
+	markets map[string]*Market
+	seq     atomic.Uint64
+}
+
+func NewExchange() *Exchange {
+	return &Exchange{
+		markets: map[string]*Market{},
+	}
+}
+
+// AddMarket creates the market of a new instrument
+func (e *Exchange) AddMarket(symbol string, options ...Option) (*Market, error) {
+	if _, ok := e.markets[symbol]; ok {
+		return nil, errors.New("market already exists")
+	}
+
+	result := NewMarket(options...)
+	result.globalSeq = &e.seq
+	e.markets[symbol] = result
+	return result, nil
+}
+
+// Seq returns the global sequence number of the last event
+func (e *Exchange) Seq() uint64 {
+	return e.seq.Load()
+}
+
+func (e *Exchange) Market(symbol string) *Market {
+	return e.markets[symbol]
+}
+
+// MassQuote replaces the maker's quotes in many markets at once, each Quote naming its market by Symbol.
+// Nothing changes unless every quote is valid and every market takes commands. Result holds the 'done' orders of each
+// quote, in the given order.
+func (e *Exchange) MassQuote(maker string, quotes []Quote) ([][]*Order, error) {
+	seen := map[string]bool{}
+	for _, quote := range quotes {
+		if _, ok := e.markets[quote.Symbol]; !ok {
+			return nil, errors.New("unknown market " + quote.Symbol)
+		}
+
+		if seen[quote.Symbol] {
+			return nil, errors.New("more than one quote for market " + quote.Symbol)
+		}
+		seen[quote.Symbol] = true
+
+		if err := quote.validate(); err != nil {
+			return nil, err
+		}
+
+		market := e.markets[quote.Symbol]
+		if err := market.refuses(); err != nil {
+			return nil, fmt.Errorf("market %s : %w", quote.Symbol, err)
+		}
+
+		if market.batch {
+			return nil, fmt.Errorf("market %s : %w", quote.Symbol, errBatchMode)
+		}
+	}
+
+	result := make([][]*Order, len(quotes))
+	for i, quote := range quotes {
+		market := e.markets[quote.Symbol]
+		if err := market.begin(Command{Type: QuoteCommand, Account: maker, Quote: quote}); err != nil {
+			return result, err
+		}
+
+		result[i] = market.requote(maker, quote)
+		market.notify()
+		market.end()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHiddenOrders(t *testing.T) {
+	market := NewMarket()
+
+	hidden := NewSell("hidden-sell", NewDecimalValue(5), NewDecimalValue(100), time.Time{})
+	hidden.Hidden = true
+	if _, _, _, err := market.ProcessOrder(hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	sales, _ := market.Depth()
+	if len(sales) != 0 {
+		t.Fatal("hidden orders should not be displayed")
+	}
+
+	if _, _, _, err := market.ProcessSellOrder("displayed-sell", NewDecimalValue(5), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	sales, _ = market.Depth()
+	if len(sales) != 1 || !sales[0].Volume.Equal(NewDecimalValue(5)) {
+		t.Fatal("only displayed volume should be published", sales)
+	}
+
+	if !market.sales.Volume.Equal(NewDecimalValue(5)) || !market.sales.HiddenVolume.Equal(NewDecimalValue(5)) {
+		t.Fatal("invalid broker volumes")
+	}
+
+	// displayed order arrived later but executes first
+	done, partial, partialVolume, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(7), NewDecimalValue(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(done) != 2 || done[0].ID != "displayed-sell" || done[1].ID != "buy-1" {
+		t.Fatal("displayed order should be done first", done)
+	}
+
+	if partial == nil || partial.ID != "hidden-sell" || !partialVolume.Equal(NewDecimalValue(2)) || !partial.Hidden {
+		t.Fatal("marketable order should reach hidden liquidity")
+	}
+
+	if !market.sales.HiddenVolume.Equal(NewDecimalValue(3)) || !market.sales.Volume.Equal(NewDecimalValue(0)) {
+		t.Fatal("invalid broker volumes after match")
+	}
+
+	sales, _ = market.Depth()
+	if len(sales) != 0 {
+		t.Fatal("level with hidden orders only should not be displayed")
+	}
+
+	if market.CancelOrder("hidden-sell") == nil || market.sales.Len != 0 {
+		t.Fatal("should be possible to cancel hidden order")
+	}
+}
@@ -0,0 +1,353 @@
+package market
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errStop ends a scan of the journal before its end
+var errStop = errors.New("stop scanning")
+
+// history returns the files of the store and of its archive named prefix, a sequence number and suffix, by sequence
+// number
+func (s *Store) history(prefix, suffix string) ([]string, error) {
+	archived, err := listDir(filepath.Join(s.dir, archiveDir), prefix, suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.list(prefix, suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := append(archived, current...)
+	sort.SliceStable(result, func(i, j int) bool { return filepath.Base(result[i]) < filepath.Base(result[j]) })
+	return result, nil
+}
+
+// fileSeq returns the sequence number naming a file of the store
+func fileSeq(path, prefix, suffix string) uint64 {
+	seq, _ := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), suffix), 10, 64)
+	return seq
+}
+
+// scan hands the journaled commands of the store and of its archive to fn in sequence order, from the segment
+// holding the command from, until fn returns errStop. A torn last record ends the journal.
+func (s *Store) scan(from uint64, fn func(Command) error) error {
+	segments, err := s.history(segmentPrefix, segmentSuffix)
+	if err != nil {
+		return err
+	}
+
+	for i, segment := range segments {
+		if i+1 < len(segments) && fileSeq(segments[i+1], segmentPrefix, segmentSuffix) <= from {
+			continue
+		}
+
+		data, err := os.ReadFile(segment)
+		if err != nil {
+			return err
+		}
+
+		_, err = parseRecords(data, fn)
+		if errors.Is(err, errStop) || (errors.Is(err, errTornRecord) && i == len(segments)-1) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("journal segment %s : %w", filepath.Base(segment), err)
+		}
+	}
+
+	return nil
+}
+
+// MarketAt materializes the market as it stood right after the command seq, from the nearest snapshot at or before
+// it and the journal, archive included. The result is read only : it refuses commands. With the options of the
+// journaled market, listeners get the events of the replayed commands.
+func (s *Store) MarketAt(seq uint64, options ...Option) (*Market, error) {
+	result, err := s.restoreBefore(seq, func(snapshot *MarketSnapshot) bool { return snapshot.Commands <= seq }, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.scan(result.commands+1, func(command Command) error {
+		if command.Seq <= result.commands {
+			return nil
+		}
+
+		if command.Seq > seq {
+			// the leg command seq did not execute
+			if result.pending != nil && command.Type == VoidCommand {
+				result.pending, result.commands = nil, seq
+			}
+			return errStop
+		}
+		return result.Apply(command)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.settle()
+	if result.commands != seq {
+		return nil, fmt.Errorf("journal ends at command %d", result.commands)
+	}
+
+	result.readOnly = true
+	return result, nil
+}
+
+// MarketAtEvent materializes the market as it stood right after the event seq, which may be in the middle of a
+// command : a disputed trade is looked at with the book it left, before the order went on matching. The result is
+// read only, and Commands is the command which made the event.
+func (s *Store) MarketAtEvent(seq uint64, options ...Option) (*Market, error) {
+	result, err := s.restoreBefore(^uint64(0), func(snapshot *MarketSnapshot) bool { return snapshot.Seq <= seq }, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	result.halt = seq
+	err = s.scan(result.commands+1, func(command Command) error {
+		if command.Seq <= result.commands {
+			return nil
+		}
+
+		if result.seq >= seq {
+			return errStop
+		}
+		return result.Apply(command)
+	})
+	if err == nil && result.seq < seq {
+		result.settle()
+	}
+	result.halt, result.halted = 0, false
+	if err != nil {
+		return nil, err
+	}
+
+	if result.seq != seq {
+		return nil, fmt.Errorf("journal ends at event %d", result.seq)
+	}
+
+	result.readOnly = true
+	return result, nil
+}
+
+// restoreBefore restores the newest snapshot of the store and of its archive which fits, skipping the ones taken
+// after the command commands without reading them, or returns an empty market. The result has no journal.
+func (s *Store) restoreBefore(commands uint64, fits func(*MarketSnapshot) bool, options ...Option) (*Market, error) {
+	snapshots, err := s.history(snapshotPrefix, snapshotSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Market
+	for i := len(snapshots) - 1; i >= 0 && result == nil; i-- {
+		if fileSeq(snapshots[i], snapshotPrefix, snapshotSuffix) > commands {
+			continue
+		}
+
+		data, err := os.ReadFile(snapshots[i])
+		if err != nil {
+			return nil, err
+		}
+
+		var snapshot MarketSnapshot
+		if snapshot.UnmarshalBinary(data) != nil || !fits(&snapshot) {
+			continue
+		}
+
+		if restored, err := RestoreMarket(&snapshot, options...); err == nil {
+			result = restored
+		}
+	}
+
+	if result == nil {
+		result = NewMarket(options...)
+	}
+	result.journal = nil
+	return result, nil
+}
+
+// MarketAtTime materializes the market as it stood at t : right after the last command journaled at or before t
+func (s *Store) MarketAtTime(t time.Time, options ...Option) (*Market, error) {
+	var seq uint64
+	err := s.scan(0, func(command Command) error {
+		if command.Time.After(t) {
+			return errStop
+		}
+
+		seq = command.Seq
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.MarketAt(seq, options...)
+}
+
+// Diff compares the book right after the command from with the book right after the command to
+func (s *Store) Diff(from, to uint64, options ...Option) (BookDiff, error) {
+	before, err := s.MarketAt(from, options...)
+	if err != nil {
+		return BookDiff{}, err
+	}
+
+	after, err := s.MarketAt(to, options...)
+	if err != nil {
+		return BookDiff{}, err
+	}
+
+	return DiffMarkets(before, after), nil
+}
+
+// OrderChange is an order which differs between two books : Before is nil for an added order, After for a removed one
+type OrderChange struct {
+	ID     string
+	Before *Order
+	After  *Order
+}
+
+// LevelChange is a price level whose displayed volume differs between two books
+type LevelChange struct {
+	Kind   Kind
+	Price  Decimal
+	Before Decimal
+	After  Decimal
+}
+
+// BookDiff tells how a book changed between two commands. Orders are sorted by ID, levels are bids then asks, best
+// price first.
+type BookDiff struct {
+	From   uint64
+	To     uint64
+	Orders []OrderChange
+	Levels []LevelChange
+}
+
+// DiffMarkets compares the books of two markets, usually the same one at two points in time
+func DiffMarkets(before, after *Market) BookDiff {
+	result := BookDiff{From: before.commands, To: after.commands}
+
+	beforeOrders, beforeLevels := bookOf(before)
+	afterOrders, afterLevels := bookOf(after)
+
+	for id, order := range beforeOrders {
+		if changed, ok := afterOrders[id]; !ok {
+			result.Orders = append(result.Orders, OrderChange{ID: id, Before: order})
+		} else if !sameOrder(order, changed) {
+			result.Orders = append(result.Orders, OrderChange{ID: id, Before: order, After: changed})
+		}
+	}
+
+	for id, order := range afterOrders {
+		if _, ok := beforeOrders[id]; !ok {
+			result.Orders = append(result.Orders, OrderChange{ID: id, After: order})
+		}
+	}
+	sort.Slice(result.Orders, func(i, j int) bool { return result.Orders[i].ID < result.Orders[j].ID })
+
+	for key, level := range beforeLevels {
+		change := LevelChange{Kind: level.Kind, Price: level.Price, Before: level.Volume, After: NewZeroDecimal()}
+		if changed, ok := afterLevels[key]; ok {
+			change.After = changed.Volume
+		}
+
+		if !change.Before.Equal(change.After) {
+			result.Levels = append(result.Levels, change)
+		}
+	}
+
+	for key, level := range afterLevels {
+		if _, ok := beforeLevels[key]; !ok {
+			result.Levels = append(result.Levels, LevelChange{Kind: level.Kind, Price: level.Price, Before: NewZeroDecimal(), After: level.Volume})
+		}
+	}
+
+	sort.Slice(result.Levels, func(i, j int) bool {
+		a, b := result.Levels[i], result.Levels[j]
+		if a.Kind != b.Kind {
+			return a.Kind == Buy
+		}
+
+		if a.Kind == Buy {
+			return a.Price.GreaterThan(b.Price)
+		}
+		return a.Price.LessThan(b.Price)
+	})
+
+	return result
+}
+
+// bookLevel is a displayed level of bookOf
+type bookLevel struct {
+	Kind   Kind
+	Price  Decimal
+	Volume Decimal
+}
+
+// bookOf returns the resting orders of a market by ID, and its displayed levels by side and price
+func bookOf(m *Market) (map[string]*Order, map[string]bookLevel) {
+	orders := map[string]*Order{}
+	levels := map[string]bookLevel{}
+
+	for _, broker := range []*Broker{m.buys, m.sales} {
+		for level := broker.MinPriceQueue(); level != nil; level = broker.GreaterThan(level.Price) {
+			for e := level.Head(); e != nil; e = level.Next(e) {
+				order := *e.Order
+				orders[order.ID] = &order
+			}
+
+			if level.Volume.Sign() > 0 {
+				kind := Sell
+				if broker == m.buys {
+					kind = Buy
+				}
+				levels[kind.String()+level.Price.String()] = bookLevel{Kind: kind, Price: level.Price, Volume: level.Volume}
+			}
+		}
+	}
+
+	return orders, levels
+}
+
+// sameOrder tells if an order rests unchanged : same volume, price and time priority
+func sameOrder(a, b *Order) bool {
+	return a.Volume.Equal(b.Volume) && a.Price.Equal(b.Price) && a.Seq == b.Seq && a.Hidden == b.Hidden
+}
+
+// String is the readable view of the diff : added orders are marked +, removed ones - and changed ones ~
+func (d BookDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "book from command %d to command %d\n", d.From, d.To)
+
+	describe := func(order *Order) string {
+		return fmt.Sprintf("%s %s@%s seq %d", order.Kind, order.Volume, order.Price, order.Seq)
+	}
+
+	for _, change := range d.Orders {
+		switch {
+		case change.Before == nil:
+			fmt.Fprintf(&b, "+ %s %s\n", change.ID, describe(change.After))
+		case change.After == nil:
+			fmt.Fprintf(&b, "- %s %s\n", change.ID, describe(change.Before))
+		default:
+			fmt.Fprintf(&b, "~ %s %s -> %s\n", change.ID, describe(change.Before), describe(change.After))
+		}
+	}
+
+	for _, change := range d.Levels {
+		fmt.Fprintf(&b, "  %s %s : %s -> %s\n", change.Kind, change.Price, change.Before, change.After)
+	}
+
+	return b.String()
+}
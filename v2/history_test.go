@@ -0,0 +1,182 @@
+package market
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarketAt(t *testing.T) {
+	start := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	engineTime := start
+	options := []Option{WithClock(func() time.Time { return engineTime })}
+
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	market, err := store.Recover(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one command a minute, a checkpoint after the first and the third
+	steps := []func() error{
+		func() error {
+			_, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(5), NewDecimalValue(101))
+			return err
+		},
+		func() error {
+			_, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(2), NewDecimalValue(101))
+			return err
+		},
+		func() error {
+			_, _, _, err := market.ProcessSellOrder("sell-2", NewDecimalValue(3), NewDecimalValue(102))
+			return err
+		},
+		func() error {
+			market.CancelOrder("sell-2")
+			return nil
+		},
+	}
+	for i, step := range steps {
+		engineTime = start.Add(time.Duration(i) * time.Minute)
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 || i == 2 {
+			if err := store.Checkpoint(market); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for seq, expected := range map[uint64]string{0: "", 1: "5", 2: "3", 3: "3", 4: "3"} {
+		past, err := store.MarketAt(seq, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		asks, _ := past.DepthTop(1)
+		if past.Commands() != seq || (expected == "" && len(asks) != 0) || (expected != "" && asks[0].Volume.String() != expected) {
+			t.Fatal("invalid book at command", seq, asks)
+		}
+	}
+
+	current, err := store.MarketAt(4, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Checksum() != market.Checksum() {
+		t.Fatal("book at the last command should be the current one")
+	}
+	if _, _, _, err := current.ProcessBuyOrder("buy-2", NewDecimalValue(1), NewDecimalValue(90)); err == nil {
+		t.Fatal("point in time market should be read only")
+	}
+
+	if _, err := store.MarketAt(5, options...); err == nil {
+		t.Fatal("market after the journal end should not be materialized")
+	}
+
+	past, err := store.MarketAtTime(start.Add(2*time.Minute+time.Second), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if past.Commands() != 3 || past.Seq() == 0 {
+		t.Fatal("invalid book at time", past.Commands())
+	}
+
+	diff, err := store.Diff(1, 3, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.Orders) != 2 || diff.Orders[0].ID != "sell-1" || !diff.Orders[0].After.Volume.Equal(NewDecimalValue(3)) ||
+		diff.Orders[1].ID != "sell-2" || diff.Orders[1].Before != nil {
+		t.Fatalf("invalid order changes %+v", diff.Orders)
+	}
+
+	if len(diff.Levels) != 2 || !diff.Levels[0].Price.Equal(NewDecimalValue(101)) || !diff.Levels[0].Before.Equal(NewDecimalValue(5)) ||
+		!diff.Levels[1].Price.Equal(NewDecimalValue(102)) || !diff.Levels[1].Before.IsZero() {
+		t.Fatalf("invalid level changes %+v", diff.Levels)
+	}
+
+	if view := diff.String(); !strings.Contains(view, "~ sell-1") || !strings.Contains(view, "+ sell-2") {
+		t.Fatal("invalid diff view", view)
+	}
+}
+
+func TestMarketAtEvent(t *testing.T) {
+	var events []Event
+	listener := WithListener(ListenerFunc(func(event Event) { events = append(events, event) }))
+
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	market, err := store.Recover(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(2), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Checkpoint(market); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessSellOrder("sell-2", NewDecimalValue(3), NewDecimalValue(101)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(4), NewDecimalValue(101)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the buy traded with sell-1 then sell-2 : the dispute is about the first trade
+	var disputed Event
+	for _, event := range events {
+		if event.Type == Traded && event.Trade.MakerOrderID == "sell-1" {
+			disputed = event
+		}
+	}
+	if disputed.Seq == 0 {
+		t.Fatal("sell-1 should have traded")
+	}
+
+	events = nil
+	past, err := store.MarketAtEvent(disputed.Seq, listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if past.Seq() != disputed.Seq || past.Commands() != 3 {
+		t.Fatal("invalid event or command of the book", past.Seq(), past.Commands())
+	}
+	if past.Order("sell-1") != nil || past.Order("sell-2") == nil || !past.Order("sell-2").Volume.Equal(NewDecimalValue(3)) {
+		t.Fatal("book should be the one left by the disputed trade only")
+	}
+	if last := events[len(events)-1]; last.Seq != disputed.Seq || last.Trade.ID != disputed.Trade.ID {
+		t.Fatal("replay should end with the disputed trade", last.Seq)
+	}
+	if _, _, _, err := past.ProcessBuyOrder("buy-2", NewDecimalValue(1), NewDecimalValue(90)); err == nil {
+		t.Fatal("point in time market should be read only")
+	}
+
+	// the book at the last event of the command is the one after it
+	after, err := store.MarketAtEvent(market.Seq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Checksum() != market.Checksum() {
+		t.Fatal("book at the last event should be the current one")
+	}
+
+	if _, err := store.MarketAtEvent(market.Seq() + 1); err == nil {
+		t.Fatal("market after the journal end should not be materialized")
+	}
+}
@@ -0,0 +1,84 @@
+package market
+
+import (
+	"errors"
+)
+
+// Impact is the estimated execution of an order against the book, without changing it
+type Impact struct {
+	Filled       Decimal // volume the book could take
+	Remaining    Decimal // volume left when liquidity, or the limit price, ran out
+	Partial      bool
+	Cost         Decimal // sum of price * volume
+	AveragePrice Decimal
+	WorstPrice   Decimal // price of the last level reached
+	Levels       int     // number of price levels consumed, even partly
+	Mid          Decimal // mid price before execution, zero if a side is empty
+	SlippageBps  Decimal // distance of AveragePrice from Mid in basis points, positive when worse than Mid
+}
+
+// EstimateImpact simulates an order of kind for volume, like MakeBuyPrice and MakeSellPrice, but reporting how it would
+// execute and how much of it would be left. A positive limit price stops the simulation at the levels it doesn't
+// cross, as for a limit order, zero simulates a market order.
+// Only displayed orders are used, so hidden ones can only make the real execution better.
+func (m *Market) EstimateImpact(kind Kind, volume, limit Decimal) (Impact, error) {
+	if volume.Sign() <= 0 {
+		return Impact{}, errors.New("invalid volume")
+	}
+
+	if limit.Sign() < 0 {
+		return Impact{}, errors.New("invalid limit price")
+	}
+
+	result := Impact{
+		Filled:       NewZeroDecimal(),
+		Remaining:    volume,
+		Cost:         NewZeroDecimal(),
+		AveragePrice: NewZeroDecimal(),
+		WorstPrice:   NewZeroDecimal(),
+		Mid:          NewZeroDecimal(),
+		SlippageBps:  NewZeroDecimal(),
+	}
+
+	var bid, ask *OrderQueue
+	m.walk(Buy, func(level *OrderQueue) bool { bid = level; return false })
+	m.walk(Sell, func(level *OrderQueue) bool { ask = level; return false })
+	if bid != nil && ask != nil {
+		result.Mid = bid.Price.Add(ask.Price).Div(NewDecimalValue(2))
+	}
+
+	opposite := Sell
+	if kind == Sell {
+		opposite = Buy
+	}
+
+	m.walk(opposite, func(level *OrderQueue) bool {
+		if limit.Sign() > 0 && !crosses(kind, limit, level.Price) {
+			return false
+		}
+
+		taken := decimalMin(level.Volume, result.Remaining)
+		result.Filled = result.Filled.Add(taken)
+		result.Remaining = result.Remaining.Sub(taken)
+		result.Cost = result.Cost.Add(level.Price.Mul(taken))
+		result.WorstPrice = level.Price
+		result.Levels++
+		return result.Remaining.Sign() > 0
+	})
+
+	result.Partial = result.Remaining.Sign() > 0
+	if result.Filled.Sign() == 0 {
+		return result, nil
+	}
+
+	result.AveragePrice = result.Cost.Div(result.Filled)
+	if result.Mid.Sign() > 0 {
+		slippage := result.AveragePrice.Sub(result.Mid)
+		if kind == Sell {
+			slippage = slippage.Neg()
+		}
+		result.SlippageBps = slippage.Div(result.Mid).Mul(NewDecimalValue(10_000))
+	}
+
+	return result, nil
+}
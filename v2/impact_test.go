@@ -0,0 +1,59 @@
+package market
+
+import (
+	"testing"
+)
+
+func TestEstimateImpact(t *testing.T) {
+	market := NewMarket()
+
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(5), NewDecimalValue(98)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(2), NewDecimalValue(102)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessSellOrder("sell-2", NewDecimalValue(2), NewDecimalValue(104)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessSellOrder("sell-3", NewDecimalValue(4), NewDecimalValue(110)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := market.EstimateImpact(Buy, NewZeroDecimal(), NewZeroDecimal()); err == nil {
+		t.Fatal("should not be possible to estimate without volume")
+	}
+
+	impact, err := market.EstimateImpact(Buy, NewDecimalValue(5), NewZeroDecimal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 * 102 + 2 * 104 + 1 * 110 = 522, mid 100
+	if !impact.Filled.Equal(NewDecimalValue(5)) || impact.Partial || !impact.Cost.Equal(NewDecimalValue(522)) ||
+		!impact.AveragePrice.Equal(NewDecimalValue(522).Div(NewDecimalValue(5))) || !impact.WorstPrice.Equal(NewDecimalValue(110)) ||
+		impact.Levels != 3 || !impact.Mid.Equal(NewDecimalValue(100)) || !impact.SlippageBps.Equal(NewDecimalValue(440)) {
+		t.Fatal("invalid market buy impact", impact)
+	}
+
+	impact, err = market.EstimateImpact(Buy, NewDecimalValue(5), NewDecimalValue(105))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !impact.Filled.Equal(NewDecimalValue(4)) || !impact.Remaining.Equal(NewDecimalValue(1)) || !impact.Partial || impact.Levels != 2 {
+		t.Fatal("invalid limit buy impact", impact)
+	}
+
+	impact, err = market.EstimateImpact(Sell, NewDecimalValue(8), NewZeroDecimal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !impact.Filled.Equal(NewDecimalValue(5)) || !impact.Remaining.Equal(NewDecimalValue(3)) || !impact.Partial ||
+		!impact.SlippageBps.Equal(NewDecimalValue(200)) {
+		t.Fatal("invalid sell impact", impact)
+	}
+
+	// the book did not change
+	if market.Order("sell-3") == nil || !market.Order("buy-1").Volume.Equal(NewDecimalValue(5)) {
+		t.Fatal("estimation should not change the book")
+	}
+}
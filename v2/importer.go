@@ -0,0 +1,332 @@
+package market
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type FlowType int
+
+const (
+	FlowSubmit        FlowType = iota + 1 // new limit order
+	FlowCancel                            // Volume is taken off a resting order
+	FlowDelete                            // resting order is removed
+	FlowExecute                           // resting order executes Volume : Kind and Price are the resting order ones
+	FlowHiddenExecute                     // hidden order executes, it was never submitted in the flow
+	FlowOther                             // nothing to replay : cross trades, halts
+)
+
+// FlowMessage is a message of a historical order flow
+type FlowMessage struct {
+	Time   time.Time
+	Type   FlowType
+	ID     string
+	Kind   Kind
+	Price  Decimal
+	Volume Decimal
+}
+
+// lobsterPriceExponent scales the integer prices of LOBSTER files : they are dollar prices times 10000
+const lobsterPriceExponent = -4
+
+// ParseLOBSTER reads a LOBSTER message file, handing each message to fn. Times of the file are seconds after the
+// midnight of day, its columns are time, event type, order ID, size, price and direction.
+func ParseLOBSTER(r io.Reader, day time.Time, fn func(FlowMessage) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	for line := 1; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		message, err := parseLOBSTER(fields, day)
+		if err != nil {
+			return fmt.Errorf("LOBSTER line %d : %w", line, err)
+		}
+
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+}
+
+func parseLOBSTER(fields []string, day time.Time) (FlowMessage, error) {
+	if len(fields) < 6 {
+		return FlowMessage{}, errors.New("missing fields")
+	}
+
+	seconds, err := decimal.NewFromString(fields[0])
+	if err != nil {
+		return FlowMessage{}, err
+	}
+
+	size, err := decimal.NewFromString(fields[3])
+	if err != nil {
+		return FlowMessage{}, err
+	}
+
+	price, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return FlowMessage{}, err
+	}
+
+	result := FlowMessage{
+		Time:   day.Add(time.Duration(seconds.Shift(9).IntPart())),
+		ID:     fields[2],
+		Kind:   Sell,
+		Price:  decimal.New(price, lobsterPriceExponent),
+		Volume: size,
+	}
+
+	switch fields[5] {
+	case "1":
+		result.Kind = Buy
+	case "-1":
+	default:
+		return FlowMessage{}, errors.New("invalid direction " + fields[5])
+	}
+
+	switch fields[1] {
+	case "1":
+		result.Type = FlowSubmit
+	case "2":
+		result.Type = FlowCancel
+	case "3":
+		result.Type = FlowDelete
+	case "4":
+		result.Type = FlowExecute
+	case "5":
+		result.Type = FlowHiddenExecute
+	case "6", "7":
+		result.Type = FlowOther
+	default:
+		return FlowMessage{}, errors.New("invalid event type " + fields[1])
+	}
+
+	return result, nil
+}
+
+// ParseOrderFlowCSV reads the CSV order flow format, handing each message to fn. Its columns are an RFC 3339
+// timestamp, the type (submit, cancel, delete or execute), the order ID, its side (buy or sell), price and size.
+// Like in LOBSTER files, executions describe the resting order. A header line is skipped.
+func ParseOrderFlowCSV(r io.Reader, fn func(FlowMessage) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 6
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	for line := 1; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if line == 1 && strings.EqualFold(fields[0], "timestamp") {
+			continue
+		}
+
+		message, err := parseOrderFlow(fields)
+		if err != nil {
+			return fmt.Errorf("order flow line %d : %w", line, err)
+		}
+
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+}
+
+func parseOrderFlow(fields []string) (FlowMessage, error) {
+	timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return FlowMessage{}, err
+	}
+
+	price, err := decimal.NewFromString(fields[4])
+	if err != nil {
+		return FlowMessage{}, err
+	}
+
+	size, err := decimal.NewFromString(fields[5])
+	if err != nil {
+		return FlowMessage{}, err
+	}
+
+	result := FlowMessage{Time: timestamp, ID: fields[2], Price: price, Volume: size}
+
+	switch strings.ToLower(fields[3]) {
+	case "buy":
+		result.Kind = Buy
+	case "sell":
+		result.Kind = Sell
+	default:
+		return FlowMessage{}, errors.New("invalid side " + fields[3])
+	}
+
+	switch strings.ToLower(fields[1]) {
+	case "submit":
+		result.Type = FlowSubmit
+	case "cancel":
+		result.Type = FlowCancel
+	case "delete":
+		result.Type = FlowDelete
+	case "execute":
+		result.Type = FlowExecute
+	default:
+		return FlowMessage{}, errors.New("invalid type " + fields[1])
+	}
+
+	return result, nil
+}
+
+// Divergence is a recorded execution the engine didn't reproduce : Filled is what the engine executed of the
+// recorded order, Trades are all the engine trades for the execution.
+type Divergence struct {
+	Message FlowMessage
+	Filled  Decimal
+	Trades  []*Trade
+}
+
+// ImportReport sums up an import. Skipped messages name orders unknown to the engine, such as the ones resting
+// before the flow starts, or have nothing to replay. Rejected ones failed the engine validation.
+type ImportReport struct {
+	Messages       int
+	Skipped        int
+	Rejected       int
+	Executions     int
+	RecordedVolume Decimal // of the replayed executions
+	FilledVolume   Decimal // of the recorded orders, by the engine
+	Divergences    []Divergence
+}
+
+// FlowImporter replays a historical order flow through a market running at the time of the messages.
+// Submissions, cancellations and deletions become orders, amendments and cancels. An execution becomes an incoming
+// order against the executed one, cancelled if not filled, so the engine fills can be compared to the recorded ones.
+type FlowImporter struct {
+	market *Market
+	time   time.Time
+	takers uint64
+	report ImportReport
+}
+
+// NewFlowImporter replays the flow through a new market with the options. Its clock is the time of the messages.
+func NewFlowImporter(options ...Option) *FlowImporter {
+	result := &FlowImporter{report: ImportReport{RecordedVolume: NewZeroDecimal(), FilledVolume: NewZeroDecimal()}}
+	result.market = NewMarket(append(options, WithClock(func() time.Time { return result.time }))...)
+	return result
+}
+
+// Market returns the market the flow is replayed through
+func (i *FlowImporter) Market() *Market {
+	return i.market
+}
+
+// Report returns the summary of the messages imported so far
+func (i *FlowImporter) Report() ImportReport {
+	return i.report
+}
+
+// Import replays a message. It is meant as the callback of ParseLOBSTER and ParseOrderFlowCSV.
+func (i *FlowImporter) Import(message FlowMessage) error {
+	i.report.Messages++
+	i.time = message.Time
+
+	m := i.market
+	e, resting := m.orders[message.ID]
+	switch message.Type {
+	case FlowSubmit:
+		order := &Order{ID: message.ID, Kind: message.Kind, Price: message.Price, Volume: message.Volume}
+		if _, _, _, err := m.ProcessOrder(order); err != nil {
+			i.report.Rejected++
+		}
+	case FlowCancel:
+		if !resting {
+			i.report.Skipped++
+			return nil
+		}
+
+		volume := e.Order.Volume.Sub(message.Volume)
+		if volume.Sign() <= 0 {
+			m.CancelOrder(message.ID)
+			return nil
+		}
+
+		if _, err := m.AmendOrder(message.ID, volume, e.Order.Price); err != nil {
+			i.report.Rejected++
+		}
+	case FlowDelete:
+		if !resting {
+			i.report.Skipped++
+			return nil
+		}
+
+		m.CancelOrder(message.ID)
+	case FlowExecute:
+		if !resting {
+			i.report.Skipped++
+			return nil
+		}
+
+		return i.execute(message)
+	case FlowHiddenExecute, FlowOther:
+		i.report.Skipped++
+	default:
+		return errors.New("unknown flow message type")
+	}
+
+	return nil
+}
+
+// execute sends an incoming order against the recorded execution and compares the engine trades with it
+func (i *FlowImporter) execute(message FlowMessage) error {
+	m := i.market
+	kind := Buy
+	if message.Kind == Buy {
+		kind = Sell
+	}
+
+	i.takers++
+	taker := &Order{ID: fmt.Sprintf("import-taker-%d", i.takers), Kind: kind, Price: message.Price, Volume: message.Volume}
+	trades, err := m.PlaceOrder(taker)
+	if err != nil {
+		i.report.Rejected++
+		return nil
+	}
+
+	if _, ok := m.orders[taker.ID]; ok {
+		m.CancelOrder(taker.ID)
+	}
+
+	filled, total := NewZeroDecimal(), NewZeroDecimal()
+	for _, trade := range trades {
+		total = total.Add(trade.Volume)
+		if trade.MakerOrderID == message.ID {
+			filled = filled.Add(trade.Volume)
+		}
+	}
+
+	i.report.Executions++
+	i.report.RecordedVolume = i.report.RecordedVolume.Add(message.Volume)
+	i.report.FilledVolume = i.report.FilledVolume.Add(filled)
+	if !filled.Equal(message.Volume) || !total.Equal(filled) {
+		i.report.Divergences = append(i.report.Divergences, Divergence{Message: message, Filled: filled, Trades: trades})
+	}
+
+	return nil
+}
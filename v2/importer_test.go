@@ -0,0 +1,84 @@
+package market
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportLOBSTER(t *testing.T) {
+	day := time.Date(2012, 6, 21, 0, 0, 0, 0, time.UTC)
+	messages := `34200.000000001,1,11,100,1010000,-1
+34200.5,1,12,50,1010000,-1
+34201,1,13,70,1000000,1
+34202,4,11,40,1010000,-1
+34203,2,12,20,1010000,-1
+34204,4,12,30,1010000,-1
+34205,3,13,70,1000000,1
+34206,3,99,10,1000000,1
+34207,5,0,10,1005000,1
+34208,7,-1,1,-1,-1
+`
+
+	importer := NewFlowImporter()
+	if err := ParseLOBSTER(strings.NewReader(messages), day, importer.Import); err != nil {
+		t.Fatal(err)
+	}
+
+	report := importer.Report()
+	if report.Messages != 10 || report.Skipped != 3 || report.Rejected != 0 || report.Executions != 2 ||
+		!report.RecordedVolume.Equal(NewDecimalValue(70)) || !report.FilledVolume.Equal(NewDecimalValue(40)) {
+		t.Fatalf("invalid report %+v", report)
+	}
+
+	// time priority fills order 11 instead of the recorded 12
+	if len(report.Divergences) != 1 || report.Divergences[0].Message.ID != "12" || !report.Divergences[0].Filled.IsZero() ||
+		len(report.Divergences[0].Trades) != 1 || report.Divergences[0].Trades[0].MakerOrderID != "11" {
+		t.Fatalf("invalid divergences %+v", report.Divergences)
+	}
+
+	market := importer.Market()
+	asks, bids := market.DepthTop(0)
+	if len(bids) != 0 || len(asks) != 1 || !asks[0].Price.Equal(NewDecimalValue(101)) || !asks[0].Volume.Equal(NewDecimalValue(60)) {
+		t.Fatal("invalid imported book", bids, asks)
+	}
+
+	if order := market.orders["11"].Order; !order.Time.Equal(day.Add(34200*time.Second+time.Nanosecond)) || !order.Volume.Equal(NewDecimalValue(30)) {
+		t.Fatalf("invalid imported order %+v", order)
+	}
+
+	if err := ParseLOBSTER(strings.NewReader("34200,1,11,100,1010000,0\n"), day, importer.Import); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatal("invalid direction should be reported", err)
+	}
+}
+
+func TestImportOrderFlowCSV(t *testing.T) {
+	flow := `timestamp,type,id,side,price,size
+2022-11-01T10:00:00Z,submit,a,sell,101.5,3
+2022-11-01T10:00:01Z,submit,b,buy,100,2
+2022-11-01T10:00:02Z,execute,a,sell,101.5,1
+2022-11-01T10:00:03Z,cancel,b,buy,100,2
+`
+
+	importer := NewFlowImporter()
+	if err := ParseOrderFlowCSV(strings.NewReader(flow), importer.Import); err != nil {
+		t.Fatal(err)
+	}
+
+	report := importer.Report()
+	if report.Messages != 4 || report.Executions != 1 || len(report.Divergences) != 0 || !report.FilledVolume.Equal(NewDecimalValue(1)) {
+		t.Fatalf("invalid report %+v", report)
+	}
+
+	market := importer.Market()
+	if _, ok := market.orders["b"]; ok {
+		t.Fatal("fully cancelled order should be removed")
+	}
+	if order := market.orders["a"].Order; !order.Volume.Equal(NewDecimalValue(2)) {
+		t.Fatalf("invalid imported order %+v", order)
+	}
+
+	if err := ParseOrderFlowCSV(strings.NewReader("2022-11-01T10:00:00Z,submit,a,short,101.5,3\n"), importer.Import); err == nil {
+		t.Fatal("invalid side should be reported")
+	}
+}
@@ -0,0 +1,394 @@
+package market
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+type CommandType uint8
+
+const (
+	OrderCommand       CommandType = iota + 1 // limit order : ProcessOrder, PlaceOrder, ProcessBuyOrder, ProcessSellOrder
+	MarketOrderCommand                        // ProcessBuy, ProcessSell : Order holds Kind and Volume
+	CancelCommand                             // Order holds ID
+	AmendCommand                              // Order holds ID, Volume and Price
+	ExpireCommand                             // Until is the time orders expire by
+	QuoteCommand                              // Account is the maker
+	PriorityCommand                           // Account gets Priority
+	AuctionCommand                            // batch of Orders cleared with Lot
+	LegCommand                                // leg of an implied spread execution : Order matches, nothing rests
+	VoidCommand                               // the leg command just before did not execute
+	SpreadCommand                             // spread Order of a spread book, Lot of it filled by implied executions
+)
+
+// Command is a journaled change of the book. Seq numbers the commands of a market without gaps. Time is the engine
+// time of the command : everything it stamps, orders, trades and events, gets that time.
+type Command struct {
+	Seq      uint64
+	Time     time.Time
+	Type     CommandType
+	Order    Order
+	Account  string
+	Quote    Quote
+	Priority Priority
+	Until    time.Time
+	Orders   []Order
+	Lot      Decimal
+}
+
+func (c *Command) encode(e *encoder) {
+	e.uint(c.Seq)
+	e.time(c.Time)
+	e.uint(uint64(c.Type))
+	e.order(&c.Order)
+	e.string(c.Account)
+	e.decimal(c.Quote.BidPrice)
+	e.decimal(c.Quote.BidVolume)
+	e.decimal(c.Quote.AskPrice)
+	e.decimal(c.Quote.AskVolume)
+	e.uint(uint64(c.Priority))
+	e.time(c.Until)
+	e.uint(uint64(len(c.Orders)))
+	for i := range c.Orders {
+		e.order(&c.Orders[i])
+	}
+	e.decimal(c.Lot)
+}
+
+func (c *Command) decode(d *decoder) {
+	c.Seq = d.uint()
+	c.Time = d.time()
+	c.Type = CommandType(d.uint())
+	c.Order = *d.order()
+	c.Account = d.string()
+	c.Quote.BidPrice = d.decimal()
+	c.Quote.BidVolume = d.decimal()
+	c.Quote.AskPrice = d.decimal()
+	c.Quote.AskVolume = d.decimal()
+	c.Priority = Priority(d.uint())
+	c.Until = d.time()
+
+	count := d.uint()
+	if count > uint64(len(d.buf)) {
+		d.fail()
+		return
+	}
+	for i := uint64(0); i < count; i++ {
+		c.Orders = append(c.Orders, *d.order())
+	}
+	c.Lot = d.decimal()
+}
+
+// recordHeader is the size of what prefixes each journal record : the length, the checksum of the payload and the
+// checksum of both, so a damaged length is told apart from a record cut short
+const recordHeader = 12
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Journal is the append-only log of the commands of a Market, written before they take effect.
+// Each record is the length of the command, its CRC-32C checksum, the checksum of that header and the command itself.
+// Once a write fails the journal is broken and the market refuses every command, so the log never misses one.
+type Journal struct {
+	w   io.Writer
+	err error
+}
+
+// NewJournal writes the commands to w. If w can Sync, as files do, each record is synced before its command runs.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w}
+}
+
+// OpenJournal opens the journal file at path for appending, creating it if needed
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJournal(file), nil
+}
+
+// WithJournal journals every command of the market
+func WithJournal(journal *Journal) Option {
+	return func(m *Market) {
+		m.journal = journal
+	}
+}
+
+// Err returns the write error which broke the journal, if any
+func (j *Journal) Err() error {
+	return j.err
+}
+
+func (j *Journal) Append(command Command) error {
+	if j.err != nil {
+		return j.err
+	}
+
+	e := encoder{buf: make([]byte, recordHeader, 128)}
+	command.encode(&e)
+	seal(e.buf)
+
+	if _, err := j.w.Write(e.buf); err != nil {
+		j.err = err
+		return err
+	}
+
+	if syncer, ok := j.w.(interface{ Sync() error }); ok {
+		if err := syncer.Sync(); err != nil {
+			j.err = err
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seal fills the header reserved at the start of a record : the size and the CRC-32C checksum of what follows, then
+// the checksum of both
+func seal(record []byte) {
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(record)-recordHeader))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(record[recordHeader:], crcTable))
+	binary.BigEndian.PutUint32(record[8:12], crc32.Checksum(record[0:8], crcTable))
+}
+
+// recordSize checks the header of a record and returns the size of its payload
+func recordSize(header []byte) (int, error) {
+	if crc32.Checksum(header[0:8], crcTable) != binary.BigEndian.Uint32(header[8:12]) {
+		return 0, errors.New("journal record header checksum mismatch")
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecord {
+		return 0, errors.New("journal record size out of range")
+	}
+	return int(size), nil
+}
+
+// checkPayload tells if payload matches the checksum of its record header
+func checkPayload(header, payload []byte) bool {
+	return crc32.Checksum(payload, crcTable) == binary.BigEndian.Uint32(header[4:8])
+}
+
+// rotate goes on writing to w, closing the previous writer
+func (j *Journal) rotate(w io.Writer) error {
+	err := j.Close()
+	j.w = w
+	return err
+}
+
+// Close closes the journal file, if it writes to one
+func (j *Journal) Close() error {
+	if closer, ok := j.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ReadJournal reads the commands of a journal in order, handing each one to fn
+func ReadJournal(r io.Reader, fn func(Command) error) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = parseRecords(data, fn)
+	return err
+}
+
+var errTornRecord = errors.New("torn journal record")
+
+// maxRecord bounds the size of a record
+const maxRecord = 1 << 24
+
+// parseRecords hands the commands of data to fn and returns the size of the valid records, see scanRecords
+func parseRecords(data []byte, fn func(Command) error) (int, error) {
+	return scanRecords(data, func(payload []byte) error {
+		var command Command
+		d := decoder{buf: payload}
+		command.decode(&d)
+		if d.err != nil {
+			return d.err
+		}
+
+		return fn(command)
+	})
+}
+
+// scanRecords hands the payloads of the records of data to fn and returns the size of the valid records. A last
+// record cut short, or failing its payload checksum with nothing after it, was torn by a crash while being written :
+// that is errTornRecord. A header failing its checksum is damage, wherever it is.
+func scanRecords(data []byte, fn func([]byte) error) (int, error) {
+	offset := 0
+	for offset < len(data) {
+		if len(data)-offset < recordHeader {
+			return offset, errTornRecord
+		}
+
+		header := data[offset : offset+recordHeader]
+		size, err := recordSize(header)
+		if err != nil {
+			return offset, err
+		}
+
+		end := offset + recordHeader + size
+		if end > len(data) {
+			return offset, errTornRecord
+		}
+
+		payload := data[offset+recordHeader : end]
+		if !checkPayload(header, payload) {
+			if end == len(data) {
+				return offset, errTornRecord
+			}
+			return offset, errors.New("journal record checksum mismatch")
+		}
+
+		if err := fn(payload); err != nil {
+			return offset, err
+		}
+		offset = end
+	}
+
+	return offset, nil
+}
+
+// Replay rebuilds a market from the journal file at path. With the options of the journaled market, the result has
+// the same book, queue order and sequence numbers, and its listeners get the same events.
+func Replay(path string, options ...Option) (*Market, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := NewMarket(options...)
+	if err := ReadJournal(file, result.Apply); err != nil {
+		return nil, err
+	}
+
+	result.settle()
+	return result, nil
+}
+
+// Apply runs a journaled command again, at its journaled time. Commands failing validation are replayed as they
+// happened, so only unknown or out of sequence commands are errors. A leg of an implied spread takes effect with the
+// next command, unless that one voids it, or once the replay settles.
+func (m *Market) Apply(command Command) error {
+	if leg := m.pending; leg != nil {
+		if command.Type == VoidCommand && command.Seq == leg.Seq+1 {
+			m.pending = nil
+			m.commands = command.Seq
+			return nil
+		}
+		m.settle()
+		if m.halted {
+			return nil
+		}
+	}
+
+	if command.Seq != m.commands+1 {
+		return errors.New("journal command out of sequence")
+	}
+
+	if command.Type == LegCommand {
+		m.pending = &command
+		return nil
+	}
+	return m.apply(command)
+}
+
+// settle runs the leg command left pending by a replay which ended without voiding it
+func (m *Market) settle() {
+	if leg := m.pending; leg != nil {
+		m.pending = nil
+		_ = m.apply(*leg)
+	}
+}
+
+func (m *Market) apply(command Command) error {
+	clock := m.clock
+	m.clock = func() time.Time { return command.Time }
+	defer func() { m.clock = clock }()
+
+	order := command.Order
+	switch command.Type {
+	case OrderCommand:
+		_, _ = m.PlaceOrder(&order)
+	case MarketOrderCommand:
+		if order.Kind == Buy {
+			_, _, _, _, _ = m.ProcessBuy(order.Volume)
+		} else {
+			_, _, _, _, _ = m.ProcessSell(order.Volume)
+		}
+	case CancelCommand:
+		m.CancelOrder(order.ID)
+	case AmendCommand:
+		_, _ = m.AmendOrder(order.ID, order.Volume, order.Price)
+	case ExpireCommand:
+		m.ExpireOrders(command.Until)
+	case QuoteCommand:
+		_, _ = m.Quote(command.Account, command.Quote)
+	case PriorityCommand:
+		_ = m.SetPriority(command.Account, command.Priority)
+	case AuctionCommand:
+		auction := NewBatchAuction(m)
+		auction.Lot = command.Lot
+		for i := range command.Orders {
+			order := command.Orders[i]
+			auction.pending = append(auction.pending, &order)
+		}
+		auction.Clear()
+	case LegCommand:
+		if m.begin(Command{Type: LegCommand, Order: order}) == nil {
+			m.executeLeg(&order)
+		}
+	case VoidCommand:
+		m.void()
+	case SpreadCommand:
+		_, _, _ = m.placeSpread(&order, command.Lot)
+	default:
+		return errors.New("unknown command")
+	}
+
+	return nil
+}
+
+// begin starts a command : it is journaled before it takes effect, and everything it stamps gets the same time
+func (m *Market) begin(command Command) error {
+	if err := m.refuses(); err != nil {
+		return err
+	}
+
+	command.Seq, command.Time = m.commands+1, m.clock()
+	if m.journal != nil {
+		if err := m.journal.Append(command); err != nil {
+			return err
+		}
+	}
+
+	m.commands = command.Seq
+	m.time = command.Time
+	return nil
+}
+
+// refuses tells why the market takes no command, if it doesn't
+func (m *Market) refuses() error {
+	if m.readOnly {
+		return errors.New("market is read only")
+	}
+
+	if m.journal != nil {
+		return m.journal.Err()
+	}
+	return nil
+}
+
+// end finishes the command started by begin
+func (m *Market) end() {
+	m.time = time.Time{}
+}
@@ -0,0 +1,265 @@
+package market
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// runCommands drives a market through every kind of journaled command
+func runCommands(t *testing.T, market *Market) {
+	t.Helper()
+
+	steps := []func() error{
+		func() error {
+			return market.SetPriority("maker", MarketMakerPriority)
+		},
+		func() error {
+			_, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(5), NewDecimalValue(101))
+			return err
+		},
+		func() error {
+			_, err := market.PlaceOrder(&Order{ID: "sell-hidden", Kind: Sell, Volume: NewDecimalValue(3), Price: NewDecimalValue(101), Hidden: true})
+			return err
+		},
+		func() error {
+			_, err := market.Quote("maker", Quote{BidPrice: NewDecimalValue(99), BidVolume: NewDecimalValue(4), AskPrice: NewDecimalValue(101), AskVolume: NewDecimalValue(4)})
+			return err
+		},
+		func() error {
+			// rejected, but still part of the history
+			if _, _, _, err := market.ProcessBuyOrder("sell-1", NewDecimalValue(1), NewDecimalValue(100)); err == nil {
+				return errors.New("duplicate order should be rejected")
+			}
+			return nil
+		},
+		func() error {
+			_, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(7), NewDecimalValue(102))
+			return err
+		},
+		func() error {
+			_, err := market.AmendOrder("sell-1", NewDecimalValue(4), NewDecimalValue(103))
+			return err
+		},
+		func() error {
+			_, err := market.PlaceOrder(&Order{ID: "buy-2", Kind: Buy, Volume: NewDecimalValue(2), Price: decimalFromParts(985, -1), ExpiresAt: time.Date(2022, 11, 1, 11, 0, 0, 0, time.UTC)})
+			return err
+		},
+		func() error {
+			_, _, _, _, err := market.ProcessSell(NewDecimalValue(3))
+			return err
+		},
+		func() error {
+			market.ExpireOrders(time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC))
+			return nil
+		},
+		func() error {
+			auction := NewBatchAuction(market)
+			if err := auction.ProcessBuyOrder("auction-buy", NewDecimalValue(6), NewDecimalValue(104)); err != nil {
+				return err
+			}
+			if err := auction.ProcessSellOrder("auction-sell", NewDecimalValue(2), NewDecimalValue(100)); err != nil {
+				return err
+			}
+			auction.Clear()
+			return nil
+		},
+		func() error {
+			market.CancelOrder("auction-buy")
+			return nil
+		},
+	}
+
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+}
+
+func decimalFromParts(coefficient int64, exponent int32) Decimal {
+	return NewDecimalValue(coefficient).Shift(exponent)
+}
+
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "market.journal")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every reading of the clock gives a new time : replay must use the journaled ones
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		engineTime = engineTime.Add(time.Millisecond)
+		return engineTime
+	}
+
+	var events []Event
+	market := NewMarket(WithClock(clock), WithJournal(journal), WithPriorityShare(decimalFromParts(5, -1)),
+		WithListener(ListenerFunc(func(event Event) { events = append(events, event) })))
+	runCommands(t, market)
+
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayedEvents []Event
+	replayed, err := Replay(path, WithClock(clock), WithPriorityShare(decimalFromParts(5, -1)),
+		WithListener(ListenerFunc(func(event Event) { replayedEvents = append(replayedEvents, event) })))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != len(replayedEvents) {
+		t.Fatal("invalid replayed events count", len(events), len(replayedEvents))
+	}
+	for i := range events {
+		if !reflect.DeepEqual(events[i], replayedEvents[i]) {
+			t.Fatalf("replayed event %d differs :\n%#v\n%#v", i, events[i], replayedEvents[i])
+		}
+	}
+
+	if replayed.Seq() != market.Seq() || replayed.lastTradeID != market.lastTradeID || !reflect.DeepEqual(replayed.priorities, market.priorities) {
+		t.Fatal("replayed market differs")
+	}
+
+	for _, kind := range []Kind{Buy, Sell} {
+		var orders, replayedOrders []Order
+		for level := market.broker(kind).MinPriceQueue(); level != nil; level = market.broker(kind).GreaterThan(level.Price) {
+			for e := level.Head(); e != nil; e = level.Next(e) {
+				orders = append(orders, *e.Order)
+			}
+		}
+		for level := replayed.broker(kind).MinPriceQueue(); level != nil; level = replayed.broker(kind).GreaterThan(level.Price) {
+			for e := level.Head(); e != nil; e = level.Next(e) {
+				replayedOrders = append(replayedOrders, *e.Order)
+			}
+		}
+
+		if len(orders) == 0 || !reflect.DeepEqual(orders, replayedOrders) {
+			t.Fatalf("replayed book differs :\n%v\n%v", orders, replayedOrders)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestJournalFailure(t *testing.T) {
+	journal := NewJournal(failingWriter{})
+	market := NewMarket(WithJournal(journal))
+
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(5), NewDecimalValue(101)); err == nil {
+		t.Fatal("command should fail when it can't be journaled")
+	}
+	if market.Order("sell-1") != nil || market.Seq() != 0 || journal.Err() == nil {
+		t.Fatal("command should not take effect")
+	}
+}
+
+func TestJournalCorruption(t *testing.T) {
+	var buffer bytes.Buffer
+	market := NewMarket(WithJournal(NewJournal(&buffer)))
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(5), NewDecimalValue(101)); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buffer.Bytes()
+	data[len(data)-1] ^= 0xff
+	if err := ReadJournal(bytes.NewReader(data), func(Command) error { return nil }); err == nil {
+		t.Fatal("corrupted record should be detected")
+	}
+}
+
+func TestJournalReplaySpread(t *testing.T) {
+	dir := t.TempDir()
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		engineTime = engineTime.Add(time.Millisecond)
+		return engineTime
+	}
+
+	var markets []*Market
+	for _, name := range []string{"front", "back"} {
+		journal, err := OpenJournal(filepath.Join(dir, name+".journal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer journal.Close()
+		markets = append(markets, NewMarket(WithClock(clock), WithJournal(journal)))
+	}
+	front, back := markets[0], markets[1]
+
+	if _, _, _, err := front.ProcessSellOrder("fs", NewDecimalValue(5), NewDecimalValue(105)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := back.ProcessBuyOrder("bb", NewDecimalValue(3), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	spreadJournal, err := OpenJournal(filepath.Join(dir, "spread.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spreadJournal.Close()
+
+	spread := NewSpread(front, back, WithClock(clock), WithJournal(spreadJournal))
+	if _, _, err := spread.ProcessSellOrder("spread-sell", NewDecimalValue(1), NewDecimalValue(4)); err != nil {
+		t.Fatal(err)
+	}
+	if fills, resting, err := spread.ProcessBuyOrder("spread-buy", NewDecimalValue(3), NewDecimalValue(5)); err != nil || len(fills) != 2 || !fills[0].Implied ||
+		!fills[0].Volume.Equal(NewDecimalValue(2)) || fills[1].OrderID != "spread-sell" || resting != nil {
+		t.Fatal("spread order then implied executions expected", fills, err)
+	}
+	markets = append(markets, spread.book)
+
+	for i, name := range []string{"front", "back", "spread"} {
+		replayed, err := Replay(filepath.Join(dir, name+".journal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayed.Checksum() != markets[i].Checksum() {
+			t.Fatal("replayed leg market differs", name)
+		}
+	}
+
+	// a back leg failing to journal voids the front leg, which replays without effect
+	backJournal := back.journal
+	back.journal = NewJournal(failingWriter{})
+	before, err := RestoreMarket(front.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := spread.ProcessBuyOrder("spread-buy-void", NewDecimalValue(1), NewDecimalValue(5)); err == nil {
+		t.Fatal("spread order should fail when the back leg can't be journaled")
+	}
+	if diff := DiffMarkets(before, front); len(diff.Orders) != 0 || len(diff.Levels) != 0 {
+		t.Fatal("front leg should not execute alone", diff)
+	}
+	replayed, err := Replay(filepath.Join(dir, "front.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.Checksum() != front.Checksum() {
+		t.Fatal("voided front leg should replay without effect")
+	}
+	back.journal = backJournal
+
+	// a leg market refusing commands fails the spread order, neither book changes
+	back.journal = NewJournal(failingWriter{})
+	back.journal.err = errors.New("disk full")
+	frontChecksum := front.Checksum()
+	if _, _, err := spread.ProcessBuyOrder("spread-buy-2", NewDecimalValue(1), NewDecimalValue(5)); err == nil {
+		t.Fatal("spread order should fail when a leg market refuses commands")
+	}
+	if front.Checksum() != frontChecksum || spread.Order("spread-buy-2") != nil {
+		t.Fatal("refused spread order should not take effect")
+	}
+}
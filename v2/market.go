@@ -2,21 +2,104 @@ package market
 
 import (
 	"errors"
+	"sort"
+	"sync/atomic"
 	"time"
 )
 
+// Market is the order book of one instrument. It is not safe for concurrent use : its methods, and the ones reading
+// or changing its book through other types, such as Store.Checkpoint, Primary.Verify or Ticker.ResetSession, must be
+// called from the goroutine using the market, unless documented otherwise.
 type Market struct {
-	orders map[string]*LinkedListElement // orderID -> *Order (via *LinkedListElement.Order)
-	sales  *Broker                       // sales (ask) manager
-	buys   *Broker                       // buys (bids) manager
+	orders    map[string]*LinkedListElement // orderID -> *Order (via *LinkedListElement.Order)
+	sales     *Broker                       // sales (ask) manager
+	buys      *Broker                       // buys (bids) manager
+	allocator Allocator                     // shares volume inside a price level
+	watchers  []func()                      // called after every change of the book
+	listeners []Listener
+	clock     Clock
+	journal   *Journal
+	time      time.Time // engine time of the running command
+	readOnly  bool      // point in time market, refusing commands
+	halt      uint64    // event a replay stops right after, zero for none
+	halted    bool      // the halt event happened : the loops of the command stop changing the book
+	batch     bool      // orders match in batch auctions only
+	pending   *Command  // leg command replayed once the next command tells it was not voided
+
+	seq       uint64         // sequence number of the last event
+	commands  uint64         // sequence number of the last command
+	globalSeq *atomic.Uint64 // exchange wide sequence, when the market belongs to one
+
+	lastTradeID uint64
+
+	priorities    map[string]Priority // account -> allocation class
+	priorityShare Decimal             // share of incoming volume reserved to market makers
+	allocationLog func(AllocationRecord)
 }
 
-func NewMarket() *Market {
-	return &Market{
-		orders: map[string]*LinkedListElement{},
-		buys:   NewBroker(),
-		sales:  NewBroker(),
+// Option configures a Market
+type Option func(*Market)
+
+// WithAllocator sets the allocation strategy of the price levels (FIFO by default)
+func WithAllocator(allocator Allocator) Option {
+	return func(m *Market) {
+		m.allocator = allocator
+	}
+}
+
+// Clock tells the engine time
+type Clock func() time.Time
+
+// WithClock sets the clock stamping orders, trades and events (UTC wall clock by default)
+func WithClock(clock Clock) Option {
+	return func(m *Market) {
+		m.clock = clock
+	}
+}
+
+func NewMarket(options ...Option) *Market {
+	result := &Market{
+		orders:    map[string]*LinkedListElement{},
+		buys:      NewBroker(),
+		sales:     NewBroker(),
+		allocator: FIFO{},
+		clock:     func() time.Time { return time.Now().UTC() },
+
+		priorities:    map[string]Priority{},
+		priorityShare: NewZeroDecimal(),
+	}
+
+	for _, option := range options {
+		option(result)
 	}
+
+	return result
+}
+
+func (m *Market) broker(kind Kind) *Broker {
+	if kind == Buy {
+		return m.buys
+	}
+
+	return m.sales
+}
+
+// now returns the time of the running command, or the clock time between commands
+func (m *Market) now() time.Time {
+	if !m.time.IsZero() {
+		return m.time
+	}
+	return m.clock()
+}
+
+// Seq returns the sequence number of the last event of the market
+func (m *Market) Seq() uint64 {
+	return m.seq
+}
+
+// Commands returns the sequence number of the last command of the market
+func (m *Market) Commands() uint64 {
+	return m.commands
 }
 
 func (m *Market) Order(orderID string) *Order {
@@ -28,7 +111,111 @@ func (m *Market) Order(orderID string) *Order {
 	return result.Order
 }
 
+// watch registers fn to be called once a command has changed the book
+func (m *Market) watch(fn func()) {
+	m.watchers = append(m.watchers, fn)
+}
+
+// listen registers a listener after the market was created
+func (m *Market) listen(listener Listener) {
+	m.listeners = append(m.listeners, listener)
+}
+
+func (m *Market) notify() {
+	for _, fn := range m.watchers {
+		fn()
+	}
+}
+
+// CancelOrder removes a resting order. Result is nil when there is no such order or when the journal failed.
 func (m *Market) CancelOrder(orderID string) *Order {
+	if err := m.begin(Command{Type: CancelCommand, Order: Order{ID: orderID}}); err != nil {
+		return nil
+	}
+	defer m.end()
+	defer m.notify()
+
+	result := m.removeOrder(orderID)
+	if result != nil {
+		m.emit(Cancelled, *result, nil, "")
+	}
+	return result
+}
+
+// AmendOrder changes volume and price of a resting order. Lowering the volume at the same price keeps the order's time
+// priority, any other change moves it to the back of its new price level, where it may trade. Result holds the trades
+// of the amended order.
+func (m *Market) AmendOrder(orderID string, volume, price Decimal) ([]*Trade, error) {
+	if err := m.begin(Command{Type: AmendCommand, Order: Order{ID: orderID, Volume: volume, Price: price}}); err != nil {
+		return nil, err
+	}
+	defer m.end()
+
+	e, ok := m.orders[orderID]
+	if !ok {
+		return nil, errors.New("order not found")
+	}
+
+	amended := *e.Order
+	amended.Volume, amended.Price = volume, price
+	if err := validate(volume, price); err != nil {
+		return nil, m.reject(&amended, err)
+	}
+
+	defer m.notify()
+
+	if price.Equal(e.Order.Price) && volume.LessThanOrEqual(e.Order.Volume) {
+		m.broker(amended.Kind).Update(e, &amended)
+		m.emit(Amended, amended, nil, "")
+		return nil, nil
+	}
+
+	m.removeOrder(orderID)
+	m.emit(Amended, amended, nil, "")
+	if m.batch {
+		m.rest(&amended)
+		return nil, nil
+	}
+
+	_, _, _, trades := m.process(&amended)
+	return trades, nil
+}
+
+// ExpireOrders removes the orders which expire at or before now, in sequence order. Result is nil when the journal
+// failed.
+func (m *Market) ExpireOrders(now time.Time) []*Order {
+	var expired []*Order
+	for _, e := range m.orders {
+		if !e.Order.ExpiresAt.IsZero() && !e.Order.ExpiresAt.After(now) {
+			expired = append(expired, e.Order)
+		}
+	}
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	if err := m.begin(Command{Type: ExpireCommand, Until: now}); err != nil {
+		return nil
+	}
+	defer m.end()
+	defer m.notify()
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Seq < expired[j].Seq })
+
+	for _, order := range expired {
+		if m.halted {
+			break
+		}
+
+		m.removeOrder(order.ID)
+		m.emit(Expired, *order, nil, "")
+	}
+
+	return expired
+}
+
+func (m *Market) removeOrder(orderID string) *Order {
 	order, ok := m.orders[orderID]
 	if !ok {
 		return nil
@@ -55,13 +242,17 @@ func (m *Market) Depth() ([]PriceVolume, []PriceVolume) {
 
 	level := m.sales.MaxPriceQueue()
 	for level != nil {
-		sales = append(sales, PriceVolume{Price: level.Price, Volume: level.Volume})
+		if level.Displayed() > 0 {
+			sales = append(sales, PriceVolume{Price: level.Price, Volume: level.Volume})
+		}
 		level = m.sales.LessThan(level.Price)
 	}
 
 	level = m.buys.MaxPriceQueue()
 	for level != nil {
-		buys = append(buys, PriceVolume{Price: level.Price, Volume: level.Volume})
+		if level.Displayed() > 0 {
+			buys = append(buys, PriceVolume{Price: level.Price, Volume: level.Volume})
+		}
 		level = m.buys.LessThan(level.Price)
 	}
 
@@ -123,36 +314,98 @@ type Processed struct {
 	VolumeLeft    Decimal
 	Partial       *Order
 	Done          []*Order
+	Trades        []*Trade
 }
 
-// processQueue processes the indicated queue for volume value
-func (m *Market) processQueue(queue *OrderQueue, volume Decimal) Processed {
+// processQueue processes the indicated queue for volume value, sharing it among orders with the market's allocator.
+// Market makers get their priority share of the volume first, then displayed orders are served and hidden orders only
+// get what is left.
+func (m *Market) processQueue(queue *OrderQueue, taker *Order, volume Decimal) Processed {
 	result := Processed{VolumeLeft: volume}
 
-	for queue.Len() > 0 && result.VolumeLeft.Sign() > 0 {
-		headOrderEl := queue.Head()
-		headOrder := headOrderEl.Order
-
-		if result.VolumeLeft.LessThan(headOrder.Volume) {
-			if headOrder.Kind == Buy {
-				result.Partial = NewBuy(headOrder.ID, headOrder.Volume.Sub(result.VolumeLeft), headOrder.Price, headOrder.Time)
-			} else {
-				result.Partial = NewSell(headOrder.ID, headOrder.Volume.Sub(result.VolumeLeft), headOrder.Price, headOrder.Time)
-			}
-			result.PartialVolume = result.VolumeLeft
-			queue.Update(headOrderEl, result.Partial)
-			result.VolumeLeft = NewZeroDecimal()
-			continue
+	if m.priorityShare.Sign() > 0 {
+		if privileged := m.privileged(elementsOf(queue.orders)); len(privileged) > 0 {
+			m.allocate(privileged, volume.Mul(m.priorityShare).Floor(), true, taker, &result)
 		}
+	}
 
-		// done offers
-		result.VolumeLeft = result.VolumeLeft.Sub(headOrder.Volume)
-		result.Done = append(result.Done, m.CancelOrder(headOrder.ID))
+	_, fifo := m.allocator.(FIFO)
+	for _, list := range []*LinkedList{queue.orders, queue.hidden} {
+		if result.VolumeLeft.Sign() <= 0 || m.halted {
+			break
+		}
+
+		if fifo {
+			m.fillFIFO(list, taker, &result)
+			continue
+		}
+		m.allocate(elementsOf(list), result.VolumeLeft, false, taker, &result)
 	}
 
 	return result
 }
 
+func elementsOf(list *LinkedList) []*LinkedListElement {
+	result := make([]*LinkedListElement, 0, list.Len)
+	for e := list.Front(); e != nil; e = e.Next() {
+		result = append(result, e)
+	}
+	return result
+}
+
+// fillFIFO fills the orders of list in time priority, from its front, as long as volume is left. It is what FIFO
+// allocates, without going through the whole level.
+func (m *Market) fillFIFO(list *LinkedList, taker *Order, result *Processed) {
+	for e := list.Front(); e != nil && result.VolumeLeft.Sign() > 0 && !m.halted; {
+		next := e.Next()
+		m.execute(e, decimalMin(result.VolumeLeft, e.Order.Volume), false, taker, result)
+		e = next
+	}
+}
+
+// allocate shares up to volume of what is left of the processed volume among the orders of elements, trading each
+// allocation with the taker
+func (m *Market) allocate(elements []*LinkedListElement, volume Decimal, priority bool, taker *Order, result *Processed) {
+	orders := make([]*Order, len(elements))
+	for i, e := range elements {
+		orders[i] = e.Order
+	}
+
+	for i, allocated := range m.allocator.Allocate(orders, decimalMin(volume, result.VolumeLeft)) {
+		if allocated.Sign() > 0 && !m.halted {
+			m.execute(elements[i], allocated, priority, taker, result)
+		}
+	}
+}
+
+// execute trades allocated of the resting order of e with the taker
+func (m *Market) execute(e *LinkedListElement, allocated Decimal, priority bool, taker *Order, result *Processed) {
+	result.VolumeLeft = result.VolumeLeft.Sub(allocated)
+
+	order := e.Order
+	trade := m.trade(order, taker, allocated)
+	result.Trades = append(result.Trades, trade)
+	if m.allocationLog != nil {
+		m.allocationLog(AllocationRecord{TradeID: trade.ID, Time: trade.Time, OrderID: order.ID, Account: order.Account, Price: order.Price, Volume: allocated, Priority: priority})
+	}
+
+	if allocated.LessThan(order.Volume) {
+		partial := *order
+		partial.Volume = order.Volume.Sub(allocated)
+		result.Partial = m.broker(order.Kind).Update(e, &partial).Order
+		result.PartialVolume = allocated
+		m.emit(Traded, partial, trade, "")
+		return
+	}
+
+	// done offers
+	result.Done = append(result.Done, m.removeOrder(order.ID))
+
+	filled := *order
+	filled.Volume = NewZeroDecimal()
+	m.emit(Traded, filled, trade, "")
+}
+
 // ProcessBuyOrder places new buy order to the Market
 //
 //	orderID - unique order ID
@@ -168,124 +421,159 @@ func (m *Market) processQueue(queue *OrderQueue, volume Decimal) Processed {
 //		partialVolume - if partial order is not nil this result contains processed volume from partial order
 //		error   - not nil if volume (or price) is less or equal 0. Or if order with given ID is exists
 func (m *Market) ProcessBuyOrder(orderID string, volume, price Decimal) ([]*Order, *Order, Decimal, error) {
-	if _, ok := m.orders[orderID]; ok {
-		return nil, nil, NewZeroDecimal(), errors.New("order already exists")
+	return m.ProcessOrder(NewBuy(orderID, volume, price, time.Time{}))
+}
+
+// ProcessSellOrder places new sell order to the Market
+//
+//	orderID - unique order ID
+//	volume - how much volume you want to sell
+//	price - no less cheap than this price
+//
+// Result :
+//
+//	 A slice of 'done' orders - if your order satisfies another order, these orders will be added to this slice.
+//	 If your own order is 'done' too, it will be placed into this slice as well
+//		partial - if your order has been 'done' but the top order is not fully done, or if your order is
+//		          'partial done' and placed to the market without full volume - partial will contain your order with volume left
+//		partialVolume - if partial order is not nil this result contains processed volume from partial order
+//		error   - not nil if volume (or price) is less or equal 0. Or if order with given ID is exists
+func (m *Market) ProcessSellOrder(orderID string, volume, price Decimal) ([]*Order, *Order, Decimal, error) {
+	return m.ProcessOrder(NewSell(orderID, volume, price, time.Time{}))
+}
+
+// bestOpposite returns the best price level an incoming order of kind could match, if its price allows it
+func (m *Market) bestOpposite(kind Kind, price Decimal) *OrderQueue {
+	best := m.buys.MaxPriceQueue()
+	if kind == Buy {
+		best = m.sales.MinPriceQueue()
 	}
 
-	if volume.Sign() <= 0 {
-		return nil, nil, NewZeroDecimal(), errors.New("invalid order volume")
+	if best != nil && crosses(kind, price, best.Price) {
+		return best
 	}
+	return nil
+}
 
-	if price.Sign() <= 0 {
-		return nil, nil, NewZeroDecimal(), errors.New("invalid order price")
+// rest adds order to the book. Its time priority is the sequence number of the Rested event.
+func (m *Market) rest(order *Order) {
+	if m.halted {
+		return
 	}
 
-	var (
-		done          []*Order
-		partial       *Order
-		partialVolume Decimal
-	)
+	order.Time = m.now()
+	order.Seq = m.seq + 1
+	m.orders[order.ID] = m.broker(order.Kind).Add(order)
+	m.emit(Rested, *order, nil, "")
+}
 
-	volumeLeft := volume
-	bestPrice := m.sales.MinPriceQueue()
-	for volumeLeft.Sign() > 0 && m.sales.Len > 0 && price.GreaterThanOrEqual(bestPrice.Price) {
-		processed := m.processQueue(bestPrice, volumeLeft)
-		done = append(done, processed.Done...)
-		partial = processed.Partial
-		partialVolume = processed.PartialVolume
-		volumeLeft = processed.VolumeLeft
-		bestPrice = m.sales.MinPriceQueue()
+// match processes the opposite side of the book for an incoming order, for as long as its price allows
+func (m *Market) match(taker *Order) Processed {
+	result := Processed{VolumeLeft: taker.Volume}
+
+	bestPrice := m.bestOpposite(taker.Kind, taker.Price)
+	for result.VolumeLeft.Sign() > 0 && bestPrice != nil && !m.halted {
+		processed := m.processQueue(bestPrice, taker, result.VolumeLeft)
+		result.Done = append(result.Done, processed.Done...)
+		result.Trades = append(result.Trades, processed.Trades...)
+		result.Partial = processed.Partial
+		result.PartialVolume = processed.PartialVolume
+		result.VolumeLeft = processed.VolumeLeft
+		bestPrice = m.bestOpposite(taker.Kind, taker.Price)
 	}
 
-	if volumeLeft.Sign() > 0 {
-		order := NewBuy(orderID, volumeLeft, price, time.Now().UTC())
+	return result
+}
 
-		if len(done) > 0 {
-			partialVolume = volume.Sub(volumeLeft)
-			partial = order
-		}
-		m.orders[orderID] = m.buys.Add(order)
-		return done, partial, partialVolume, nil
+// ProcessOrder places new order to the Market, buy or sell and displayed or hidden as described by the order.
+// Hidden orders execute like the displayed ones, but rest out of Depth and after displayed orders at their price.
+// Result is the same as for ProcessBuyOrder and ProcessSellOrder.
+func (m *Market) ProcessOrder(order *Order) ([]*Order, *Order, Decimal, error) {
+	if err := m.begin(Command{Type: OrderCommand, Order: *order}); err != nil {
+		return nil, nil, NewZeroDecimal(), err
 	}
+	defer m.end()
 
-	totalVolume := NewZeroDecimal()
-	totalPrice := NewZeroDecimal()
+	if err := m.accept(order); err != nil {
+		return nil, nil, NewZeroDecimal(), err
+	}
+
+	defer m.notify()
 
-	for _, order := range done {
-		totalVolume = totalVolume.Add(order.Volume)
-		totalPrice = totalPrice.Add(order.Price.Mul(order.Volume))
+	done, partial, partialVolume, _ := m.process(order)
+	return done, partial, partialVolume, nil
+}
+
+// PlaceOrder places new order to the Market like ProcessOrder, but returns one Trade per match, in execution order
+func (m *Market) PlaceOrder(order *Order) ([]*Trade, error) {
+	if err := m.begin(Command{Type: OrderCommand, Order: *order}); err != nil {
+		return nil, err
 	}
+	defer m.end()
 
-	if partialVolume.Sign() > 0 {
-		totalVolume = totalVolume.Add(partialVolume)
-		totalPrice = totalPrice.Add(partial.Price.Mul(partialVolume))
+	if err := m.accept(order); err != nil {
+		return nil, err
 	}
 
-	done = append(done, NewBuy(orderID, volume, totalPrice.Div(totalVolume), time.Now().UTC()))
-	return done, partial, partialVolume, nil
+	defer m.notify()
+
+	_, _, _, trades := m.process(order)
+	return trades, nil
 }
 
-// ProcessSellOrder places new sell order to the Market
-//
-//	orderID - unique order ID
-//	volume - how much volume you want to sell
-//	price - no less cheap than this price
-//
-// Result :
-//
-//	 A slice of 'done' orders - if your order satisfies another order, these orders will be added to this slice.
-//	 If your own order is 'done' too, it will be placed into this slice as well
-//		partial - if your order has been 'done' but the top order is not fully done, or if your order is
-//		          'partial done' and placed to the market without full volume - partial will contain your order with volume left
-//		partialVolume - if partial order is not nil this result contains processed volume from partial order
-//		error   - not nil if volume (or price) is less or equal 0. Or if order with given ID is exists
-func (m *Market) ProcessSellOrder(orderID string, volume, price Decimal) ([]*Order, *Order, Decimal, error) {
-	if _, ok := m.orders[orderID]; ok {
-		return nil, nil, NewZeroDecimal(), errors.New("order already exists")
+// accept validates a new order, reporting it as accepted or rejected
+func (m *Market) accept(order *Order) error {
+	if _, ok := m.orders[order.ID]; ok {
+		return m.reject(order, errors.New("order already exists"))
+	}
+
+	if err := validate(order.Volume, order.Price); err != nil {
+		return m.reject(order, err)
 	}
 
+	if m.batch {
+		return m.reject(order, errBatchMode)
+	}
+
+	m.emit(Accepted, *order, nil, "")
+	return nil
+}
+
+func validate(volume, price Decimal) error {
 	if volume.Sign() <= 0 {
-		return nil, nil, NewZeroDecimal(), errors.New("invalid order volume")
+		return errors.New("invalid order volume")
 	}
 
 	if price.Sign() <= 0 {
-		return nil, nil, NewZeroDecimal(), errors.New("invalid order price")
+		return errors.New("invalid order price")
 	}
 
-	var (
-		done          []*Order
-		partial       *Order
-		partialVolume Decimal
-	)
+	return nil
+}
 
-	volumeLeft := volume
-	bestPrice := m.buys.MaxPriceQueue()
-	for volumeLeft.Sign() > 0 && m.buys.Len > 0 && price.LessThanOrEqual(bestPrice.Price) {
-		processed := m.processQueue(bestPrice, volumeLeft)
-		done = append(done, processed.Done...)
-		partial = processed.Partial
-		partialVolume = processed.PartialVolume
-		volumeLeft = processed.VolumeLeft
-		bestPrice = m.buys.MaxPriceQueue()
-	}
+// process matches a valid order and rests whatever volume is left
+func (m *Market) process(order *Order) ([]*Order, *Order, Decimal, []*Trade) {
+	processed := m.match(order)
+	done, partial, partialVolume, volumeLeft := processed.Done, processed.Partial, processed.PartialVolume, processed.VolumeLeft
 
 	if volumeLeft.Sign() > 0 {
-		order := NewSell(orderID, volumeLeft, price, time.Now().UTC())
+		resting := *order
+		resting.Volume = volumeLeft
 
 		if len(done) > 0 {
-			partialVolume = volume.Sub(volumeLeft)
-			partial = order
+			partialVolume = order.Volume.Sub(volumeLeft)
+			partial = &resting
 		}
-		m.orders[orderID] = m.sales.Add(order)
-		return done, partial, partialVolume, nil
+		m.rest(&resting)
+		return done, partial, partialVolume, processed.Trades
 	}
 
 	totalVolume := NewZeroDecimal()
 	totalPrice := NewZeroDecimal()
 
-	for _, order := range done {
-		totalVolume = totalVolume.Add(order.Volume)
-		totalPrice = totalPrice.Add(order.Price.Mul(order.Volume))
+	for _, doneOrder := range done {
+		totalVolume = totalVolume.Add(doneOrder.Volume)
+		totalPrice = totalPrice.Add(doneOrder.Price.Mul(doneOrder.Volume))
 	}
 
 	if partialVolume.Sign() > 0 {
@@ -293,24 +581,39 @@ func (m *Market) ProcessSellOrder(orderID string, volume, price Decimal) ([]*Ord
 		totalPrice = totalPrice.Add(partial.Price.Mul(partialVolume))
 	}
 
-	done = append(done, NewSell(orderID, volume, totalPrice.Div(totalVolume), time.Now().UTC()))
-	return done, partial, partialVolume, nil
+	filled := *order
+	filled.Price = totalPrice.Div(totalVolume)
+	filled.Time = m.now()
+	done = append(done, &filled)
+	return done, partial, partialVolume, processed.Trades
 }
 
 // ProcessSell - sells a volume
 func (m *Market) ProcessSell(volume Decimal) ([]*Order, *Order, Decimal, Decimal, error) {
+	if err := m.begin(Command{Type: MarketOrderCommand, Order: Order{Kind: Sell, Volume: volume}}); err != nil {
+		return nil, nil, NewZeroDecimal(), NewZeroDecimal(), err
+	}
+	defer m.end()
 
 	if volume.Sign() <= 0 {
-		return nil, nil, NewZeroDecimal(), NewZeroDecimal(), errors.New("invalid volume")
+		return nil, nil, NewZeroDecimal(), NewZeroDecimal(), m.reject(&Order{Kind: Sell, Volume: volume}, errors.New("invalid volume"))
+	}
+
+	if m.batch {
+		return nil, nil, NewZeroDecimal(), NewZeroDecimal(), m.reject(&Order{Kind: Sell, Volume: volume}, errBatchMode)
 	}
 
+	defer m.notify()
+
 	var done []*Order
 	var partial *Order
 	var partialVolume, volumeLeft Decimal
 
-	for volume.Sign() > 0 && m.buys.Len > 0 {
+	taker := &Order{Kind: Sell, Volume: volume}
+	m.emit(Accepted, *taker, nil, "")
+	for volume.Sign() > 0 && m.buys.Len > 0 && !m.halted {
 		bestPrice := m.buys.MaxPriceQueue()
-		processed := m.processQueue(bestPrice, volume)
+		processed := m.processQueue(bestPrice, taker, volume)
 		done = append(done, processed.Done...)
 		partial = processed.Partial
 		partialVolume = processed.PartialVolume
@@ -323,17 +626,29 @@ func (m *Market) ProcessSell(volume Decimal) ([]*Order, *Order, Decimal, Decimal
 
 // ProcessBuy - buys for a volume
 func (m *Market) ProcessBuy(volume Decimal) ([]*Order, *Order, Decimal, Decimal, error) {
+	if err := m.begin(Command{Type: MarketOrderCommand, Order: Order{Kind: Buy, Volume: volume}}); err != nil {
+		return nil, nil, NewZeroDecimal(), NewZeroDecimal(), err
+	}
+	defer m.end()
 	if volume.Sign() <= 0 {
-		return nil, nil, NewZeroDecimal(), NewZeroDecimal(), errors.New("invalid volume")
+		return nil, nil, NewZeroDecimal(), NewZeroDecimal(), m.reject(&Order{Kind: Buy, Volume: volume}, errors.New("invalid volume"))
 	}
 
+	if m.batch {
+		return nil, nil, NewZeroDecimal(), NewZeroDecimal(), m.reject(&Order{Kind: Buy, Volume: volume}, errBatchMode)
+	}
+
+	defer m.notify()
+
 	var done []*Order
 	var partial *Order
 	var partialVolume, volumeLeft Decimal
 
-	for volume.Sign() > 0 && m.sales.Len > 0 {
+	taker := &Order{Kind: Buy, Volume: volume}
+	m.emit(Accepted, *taker, nil, "")
+	for volume.Sign() > 0 && m.sales.Len > 0 && !m.halted {
 		bestPrice := m.sales.MinPriceQueue()
-		processed := m.processQueue(bestPrice, volume)
+		processed := m.processQueue(bestPrice, taker, volume)
 		done = append(done, processed.Done...)
 		partial = processed.Partial
 		partialVolume = processed.PartialVolume
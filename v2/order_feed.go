@@ -0,0 +1,181 @@
+package market
+
+type OrderMessageType int
+
+const (
+	OrderAdded    OrderMessageType = iota // order entered the book at Position
+	OrderModified                         // order volume changed, keeping its place
+	OrderExecuted                         // order traded Volume, it leaves the book once nothing is left
+	OrderDeleted                          // order left the book without trading
+	HiddenTraded                          // a non-displayed order traded, without a reference
+)
+
+func (t OrderMessageType) String() string {
+	switch t {
+	case OrderAdded:
+		return "add"
+	case OrderModified:
+		return "modify"
+	case OrderExecuted:
+		return "execute"
+	case OrderDeleted:
+		return "delete"
+	case HiddenTraded:
+		return "hidden trade"
+	default:
+		return "unknown message"
+	}
+}
+
+// OrderMessage is a message of the order-by-order feed. Orders are known by a public reference, never by their ID or
+// account. Volume is the new order volume for adds and modifications and the traded volume for executions.
+// Position is the number of displayed orders ahead at the price level, for adds.
+type OrderMessage struct {
+	Seq      uint64
+	Type     OrderMessageType
+	Ref      uint64
+	Kind     Kind
+	Price    Decimal
+	Volume   Decimal
+	Position int
+	TradeID  uint64
+}
+
+// OrderSnapshot is the full L3 book as a list of adds, in price and time priority, as of the message Seq
+type OrderSnapshot struct {
+	Seq    uint64
+	Orders []OrderMessage
+}
+
+// OrderFeed is the L3 (market-by-order) feed of a Market. It follows every change of the displayed orders : hidden
+// orders are never published, their executions come as HiddenTraded messages. Orders of a DarkPool never reach the
+// lit book, so they are not part of the feed either.
+type OrderFeed struct {
+	market    *Market
+	refs      map[string]feedOrder // orderID -> displayed resting order
+	lastRef   uint64
+	seq       uint64
+	onMessage func(OrderMessage)
+}
+
+func NewOrderFeed(market *Market, onMessage func(OrderMessage)) *OrderFeed {
+	result := &OrderFeed{
+		market:    market,
+		refs:      map[string]feedOrder{},
+		onMessage: onMessage,
+	}
+
+	for _, order := range result.displayed() {
+		result.lastRef++
+		result.refs[order.ID] = feedOrder{ref: result.lastRef, price: order.Price}
+	}
+
+	market.listen(result)
+	return result
+}
+
+// displayed returns the displayed resting orders, bids then asks, best price first and in time priority
+func (f *OrderFeed) displayed() []*Order {
+	var result []*Order
+	for level := f.market.buys.MaxPriceQueue(); level != nil; level = f.market.buys.LessThan(level.Price) {
+		for e := level.orders.Front(); e != nil; e = e.Next() {
+			result = append(result, e.Order)
+		}
+	}
+
+	for level := f.market.sales.MinPriceQueue(); level != nil; level = f.market.sales.GreaterThan(level.Price) {
+		for e := level.orders.Front(); e != nil; e = e.Next() {
+			result = append(result, e.Order)
+		}
+	}
+
+	return result
+}
+
+// Seq returns the sequence number of the last message
+func (f *OrderFeed) Seq() uint64 {
+	return f.seq
+}
+
+// Snapshot returns the displayed orders, tagged with the sequence number of the last message
+func (f *OrderFeed) Snapshot() OrderSnapshot {
+	result := OrderSnapshot{Seq: f.seq}
+
+	position, previous := 0, (*Order)(nil)
+	for _, order := range f.displayed() {
+		if previous == nil || previous.Kind != order.Kind || !previous.Price.Equal(order.Price) {
+			position = 0
+		}
+		previous = order
+
+		result.Orders = append(result.Orders, OrderMessage{Type: OrderAdded, Ref: f.refs[order.ID].ref, Kind: order.Kind, Price: order.Price, Volume: order.Volume, Position: position})
+		position++
+	}
+
+	return result
+}
+
+func (f *OrderFeed) OnEvent(event Event) {
+	order := event.Order
+	resting, known := f.refs[order.ID]
+	ref := resting.ref
+
+	switch event.Type {
+	case Rested:
+		if order.Hidden {
+			return
+		}
+
+		f.lastRef++
+		f.refs[order.ID] = feedOrder{ref: f.lastRef, price: order.Price}
+		position := f.market.broker(order.Kind).Level(order.Price).Displayed() - 1
+		f.publish(OrderMessage{Type: OrderAdded, Ref: f.lastRef, Kind: order.Kind, Price: order.Price, Volume: order.Volume, Position: position})
+
+	case Amended:
+		if !known {
+			return
+		}
+
+		// an amendment keeping the order in place is a modification, otherwise the order is added again once rested
+		if e, ok := f.market.orders[order.ID]; ok && e.Order.Price.Equal(resting.price) {
+			f.publish(OrderMessage{Type: OrderModified, Ref: ref, Kind: order.Kind, Price: order.Price, Volume: order.Volume})
+			return
+		}
+
+		delete(f.refs, order.ID)
+		f.publish(OrderMessage{Type: OrderDeleted, Ref: ref, Kind: order.Kind, Price: resting.price})
+
+	case Traded:
+		if !known {
+			f.publish(OrderMessage{Type: HiddenTraded, Kind: order.Kind, Price: event.Trade.Price, Volume: event.Trade.Volume, TradeID: event.Trade.ID})
+			return
+		}
+
+		if order.Volume.Sign() <= 0 {
+			delete(f.refs, order.ID)
+		}
+		f.publish(OrderMessage{Type: OrderExecuted, Ref: ref, Kind: order.Kind, Price: event.Trade.Price, Volume: event.Trade.Volume, TradeID: event.Trade.ID})
+
+	case Cancelled, Expired:
+		if !known {
+			return
+		}
+
+		delete(f.refs, order.ID)
+		f.publish(OrderMessage{Type: OrderDeleted, Ref: ref, Kind: order.Kind, Price: order.Price})
+	}
+}
+
+// feedOrder is what the feed knows of a published order
+type feedOrder struct {
+	ref   uint64
+	price Decimal
+}
+
+func (f *OrderFeed) publish(message OrderMessage) {
+	f.seq++
+	message.Seq = f.seq
+	if f.onMessage != nil {
+		f.onMessage(message)
+	}
+}
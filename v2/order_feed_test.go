@@ -0,0 +1,111 @@
+package market
+
+import (
+	"testing"
+)
+
+func TestOrderFeed(t *testing.T) {
+	market := NewMarket()
+	if _, _, _, err := market.ProcessSellOrder("sell-early", NewDecimalValue(5), NewDecimalValue(110)); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []OrderMessage
+	feed := NewOrderFeed(market, func(message OrderMessage) { messages = append(messages, message) })
+
+	// the consumer rebuilds the book by public reference
+	book := map[uint64]OrderMessage{}
+	for _, order := range feed.Snapshot().Orders {
+		book[order.Ref] = order
+	}
+
+	apply := func() {
+		for _, message := range messages {
+			switch message.Type {
+			case OrderAdded:
+				book[message.Ref] = message
+			case OrderModified:
+				order := book[message.Ref]
+				order.Volume = message.Volume
+				book[message.Ref] = order
+			case OrderExecuted:
+				order := book[message.Ref]
+				order.Volume = order.Volume.Sub(message.Volume)
+				book[message.Ref] = order
+				if order.Volume.Sign() <= 0 {
+					delete(book, message.Ref)
+				}
+			case OrderDeleted:
+				delete(book, message.Ref)
+			}
+		}
+		messages = nil
+
+		expected := feed.Snapshot().Orders
+		if len(expected) != len(book) {
+			t.Fatalf("rebuilt book has %d orders instead of %d", len(book), len(expected))
+		}
+		for _, order := range expected {
+			if got := book[order.Ref]; got.Kind != order.Kind || !got.Price.Equal(order.Price) || !got.Volume.Equal(order.Volume) {
+				t.Fatal("rebuilt order differs", got, order)
+			}
+		}
+	}
+
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(2), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessSellOrder("sell-2", NewDecimalValue(3), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[1].Type != OrderAdded || messages[1].Position != 1 || messages[1].Ref == messages[0].Ref {
+		t.Fatal("second order should be added behind the first one", messages)
+	}
+	apply()
+
+	if _, _, _, err := market.ProcessOrder(&Order{ID: "sell-hidden", Kind: Sell, Volume: NewDecimalValue(4), Price: NewDecimalValue(100), Hidden: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Fatal("hidden order should not be published", messages)
+	}
+
+	if _, err := market.AmendOrder("sell-2", NewDecimalValue(1), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Type != OrderModified {
+		t.Fatal("lowering the volume should modify the order", messages)
+	}
+	apply()
+
+	if _, err := market.AmendOrder("sell-early", NewDecimalValue(5), NewDecimalValue(105)); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Type != OrderDeleted || messages[1].Type != OrderAdded || messages[1].Position != 0 {
+		t.Fatal("moving the order should delete and add it", messages)
+	}
+	apply()
+
+	// takes sell-1, sell-2, 3 pcs of the hidden order
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(6), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 3 || messages[0].Type != OrderExecuted || messages[1].Type != OrderExecuted || messages[2].Type != HiddenTraded || messages[2].Ref != 0 {
+		t.Fatal("invalid executions", messages)
+	}
+	apply()
+
+	if _, _, _, err := market.ProcessBuyOrder("buy-2", NewDecimalValue(1), NewDecimalValue(90)); err != nil {
+		t.Fatal(err)
+	}
+	market.CancelOrder("buy-2")
+	market.CancelOrder("sell-hidden")
+	if len(messages) != 2 || messages[1].Type != OrderDeleted {
+		t.Fatal("only the displayed cancel should be published", messages)
+	}
+	apply()
+
+	if feed.Seq() != 10 {
+		t.Fatal("invalid feed sequence", feed.Seq())
+	}
+}
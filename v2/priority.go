@@ -0,0 +1,69 @@
+package market
+
+import "time"
+
+// Priority is the allocation class of an account
+type Priority int
+
+const (
+	RegularPriority     Priority = iota
+	MarketMakerPriority          // designated market maker, served first from the priority share
+)
+
+// AllocationRecord tells how much volume a resting order got from a fill, in which trade, and whether it came from the
+// priority share
+type AllocationRecord struct {
+	TradeID  uint64
+	Time     time.Time
+	OrderID  string
+	Account  string
+	Price    Decimal
+	Volume   Decimal
+	Priority bool
+}
+
+// WithPriorityShare sets the share (0 to 1) of each incoming volume which goes first to displayed orders of market
+// maker accounts at a price level. The share is rounded down to whole units, the rest follows normal priority.
+func WithPriorityShare(share Decimal) Option {
+	return func(m *Market) {
+		m.priorityShare = share
+	}
+}
+
+// WithAllocationLog sets the function receiving a record for every allocation made to a resting order
+func WithAllocationLog(log func(AllocationRecord)) Option {
+	return func(m *Market) {
+		m.allocationLog = log
+	}
+}
+
+// SetPriority sets the allocation class of an account
+func (m *Market) SetPriority(account string, priority Priority) error {
+	if err := m.begin(Command{Type: PriorityCommand, Account: account, Priority: priority}); err != nil {
+		return err
+	}
+	defer m.end()
+
+	if priority == RegularPriority {
+		delete(m.priorities, account)
+		return nil
+	}
+
+	m.priorities[account] = priority
+	return nil
+}
+
+func (m *Market) Priority(account string) Priority {
+	return m.priorities[account]
+}
+
+// privileged returns the elements of orders from market maker accounts
+func (m *Market) privileged(elements []*LinkedListElement) []*LinkedListElement {
+	var result []*LinkedListElement
+	for _, e := range elements {
+		if m.priorities[e.Order.Account] == MarketMakerPriority {
+			result = append(result, e)
+		}
+	}
+	return result
+}
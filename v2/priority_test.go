@@ -0,0 +1,56 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarketMakerPriority(t *testing.T) {
+	var records []AllocationRecord
+	market := NewMarket(
+		WithPriorityShare(NewDecimalValue(1).Div(NewDecimalValue(2))),
+		WithAllocationLog(func(record AllocationRecord) { records = append(records, record) }),
+	)
+	market.SetPriority("dmm", MarketMakerPriority)
+
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(10), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	order := NewSell("dmm-sell", NewDecimalValue(10), NewDecimalValue(100), time.Time{})
+	order.Account = "dmm"
+	if _, _, _, err := market.ProcessOrder(order); err != nil {
+		t.Fatal(err)
+	}
+
+	// half of 9 rounded down goes to the market maker, the rest in time priority
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(9), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !market.Order("dmm-sell").Volume.Equal(NewDecimalValue(6)) || !market.Order("sell-1").Volume.Equal(NewDecimalValue(5)) {
+		t.Fatal("invalid priority allocation", market.Order("dmm-sell").Volume, market.Order("sell-1").Volume)
+	}
+
+	if len(records) != 2 || records[0].OrderID != "dmm-sell" || !records[0].Priority || records[0].Account != "dmm" ||
+		records[1].OrderID != "sell-1" || records[1].Priority || !records[1].Volume.Equal(NewDecimalValue(5)) {
+		t.Fatal("invalid allocation records", records)
+	}
+
+	if records[0].TradeID == 0 || records[1].TradeID != records[0].TradeID+1 || records[0].Time.IsZero() {
+		t.Fatal("allocation records should name their trades", records)
+	}
+
+	market.SetPriority("dmm", RegularPriority)
+	if market.Priority("dmm") != RegularPriority {
+		t.Fatal("invalid account priority")
+	}
+
+	if _, _, _, err := market.ProcessBuyOrder("buy-2", NewDecimalValue(6), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	if market.Order("sell-1") != nil || !market.Order("dmm-sell").Volume.Equal(NewDecimalValue(5)) {
+		t.Fatal("regular accounts should follow time priority")
+	}
+}
@@ -114,53 +114,100 @@ func (l *LinkedList) Append(v *Order) *LinkedListElement {
 	return l.insertValue(v, l.root.prev)
 }
 
-// OrderQueue stores and manage chain of orders
+// OrderQueue stores and manage chain of orders.
+// Hidden orders are chained after the displayed ones and are not part of Volume.
 type OrderQueue struct {
-	Volume Decimal
-	Price  Decimal
-	orders *LinkedList
+	Volume       Decimal // displayed volume
+	HiddenVolume Decimal
+	Price        Decimal
+	orders       *LinkedList
+	hidden       *LinkedList
 }
 
 // NewQueue creates and initialize OrderQueue object
 func NewQueue(price Decimal) *OrderQueue {
 	return &OrderQueue{
-		Price:  price,
-		Volume: NewZeroDecimal(),
-		orders: NewList(),
+		Price:        price,
+		Volume:       NewZeroDecimal(),
+		HiddenVolume: NewZeroDecimal(),
+		orders:       NewList(),
+		hidden:       NewList(),
 	}
 }
 
 // Len returns amount of orders in queue
 func (q *OrderQueue) Len() int {
+	return q.orders.Len + q.hidden.Len
+}
+
+// Displayed returns amount of displayed orders in queue
+func (q *OrderQueue) Displayed() int {
 	return q.orders.Len
 }
 
+// TotalVolume returns displayed and hidden volume
+func (q *OrderQueue) TotalVolume() Decimal {
+	return q.Volume.Add(q.HiddenVolume)
+}
+
 // Head returns top order in queue
 func (q *OrderQueue) Head() *LinkedListElement {
-	return q.orders.Front()
+	if q.orders.Len > 0 {
+		return q.orders.Front()
+	}
+	return q.hidden.Front()
 }
 
 // Tail returns bottom order in queue
 func (q *OrderQueue) Tail() *LinkedListElement {
+	if q.hidden.Len > 0 {
+		return q.hidden.Back()
+	}
 	return q.orders.Back()
 }
 
+// Next returns the order after e in queue, going from displayed to hidden orders, or nil
+func (q *OrderQueue) Next(e *LinkedListElement) *LinkedListElement {
+	if next := e.Next(); next != nil {
+		return next
+	}
+
+	if e.parent == q.orders {
+		return q.hidden.Front()
+	}
+
+	return nil
+}
+
 // Add adds order to tail of the queue
 func (q *OrderQueue) Add(order *Order) *LinkedListElement {
+	if order.Hidden {
+		q.HiddenVolume = q.HiddenVolume.Add(order.Volume)
+		return q.hidden.Append(order)
+	}
+
 	q.Volume = q.Volume.Add(order.Volume)
 	return q.orders.Append(order)
 }
 
 // Update sets up new order to list value
 func (q *OrderQueue) Update(element *LinkedListElement, order *Order) *LinkedListElement {
-	q.Volume = q.Volume.Sub(element.Order.Volume)
-	q.Volume = q.Volume.Add(order.Volume)
+	if element.Order.Hidden {
+		q.HiddenVolume = q.HiddenVolume.Sub(element.Order.Volume).Add(order.Volume)
+	} else {
+		q.Volume = q.Volume.Sub(element.Order.Volume).Add(order.Volume)
+	}
 	element.Order = order
 	return element
 }
 
 // Remove removes order from the queue and link order chain
 func (q *OrderQueue) Remove(e *LinkedListElement) *Order {
+	if e.Order.Hidden {
+		q.HiddenVolume = q.HiddenVolume.Sub(e.Order.Volume)
+		return q.hidden.Remove(e).(*Order)
+	}
+
 	q.Volume = q.Volume.Sub(e.Order.Volume)
 	return q.orders.Remove(e).(*Order)
 }
@@ -172,12 +219,23 @@ const (
 	Buy
 )
 
+func (k Kind) String() string {
+	if k == Buy {
+		return "buy"
+	}
+	return "sell"
+}
+
 type Order struct {
-	Time   time.Time
-	ID     string
-	Volume Decimal
-	Price  Decimal
-	Kind   Kind
+	Time      time.Time
+	ExpiresAt time.Time // zero for orders which don't expire
+	Seq       uint64    // time priority in the book
+	ID        string
+	Account   string
+	Volume    Decimal
+	Price     Decimal
+	Kind      Kind
+	Hidden    bool // not displayed, executes after displayed orders at the same price
 }
 
 func NewBuy(orderID string, quantity, price Decimal, timestamp time.Time) *Order {
@@ -0,0 +1,152 @@
+package market
+
+import (
+	"errors"
+)
+
+// Quote is the two-sided quote of a market maker : at most one bid and one ask per maker and market.
+// A side with zero volume is not quoted. Symbol is only used by Exchange.MassQuote.
+type Quote struct {
+	Symbol    string
+	BidPrice  Decimal
+	BidVolume Decimal
+	AskPrice  Decimal
+	AskVolume Decimal
+}
+
+// quoteOrderID is the ID of the order holding one side of a maker's quote
+func quoteOrderID(maker string, kind Kind) string {
+	if kind == Buy {
+		return maker + "/bid"
+	}
+
+	return maker + "/ask"
+}
+
+func (q Quote) validate() error {
+	if q.BidVolume.Sign() < 0 || q.AskVolume.Sign() < 0 {
+		return errors.New("invalid quote volume")
+	}
+
+	if q.BidVolume.Sign() > 0 {
+		if err := validate(q.BidVolume, q.BidPrice); err != nil {
+			return err
+		}
+	}
+
+	if q.AskVolume.Sign() > 0 {
+		if err := validate(q.AskVolume, q.AskPrice); err != nil {
+			return err
+		}
+	}
+
+	if q.BidVolume.Sign() > 0 && q.AskVolume.Sign() > 0 && q.BidPrice.GreaterThanOrEqual(q.AskPrice) {
+		return errors.New("quote bid must be lower than ask")
+	}
+
+	return nil
+}
+
+// QuoteOf returns what is left of the maker's quote in the book
+func (m *Market) QuoteOf(maker string) (Quote, bool) {
+	result := Quote{BidPrice: NewZeroDecimal(), BidVolume: NewZeroDecimal(), AskPrice: NewZeroDecimal(), AskVolume: NewZeroDecimal()}
+
+	bid, hasBid := m.orders[quoteOrderID(maker, Buy)]
+	if hasBid {
+		result.BidPrice, result.BidVolume = bid.Order.Price, bid.Order.Volume
+	}
+
+	ask, hasAsk := m.orders[quoteOrderID(maker, Sell)]
+	if hasAsk {
+		result.AskPrice, result.AskVolume = ask.Order.Price, ask.Order.Volume
+	}
+
+	return result, hasBid || hasAsk
+}
+
+// Quote replaces the maker's quote with a new one, atomically : both sides are checked before any of them changes.
+// A side keeping its price and not growing in volume is updated in place and keeps its time priority, otherwise it
+// is replaced and may trade like any incoming order. Quote orders belong to the maker account and are named after it,
+// with a "/bid" or "/ask" suffix. Both sides of an invalid quote are reported rejected. Result holds the 'done' orders
+// of the trades, like ProcessOrder.
+func (m *Market) Quote(maker string, quote Quote) ([]*Order, error) {
+	if err := m.begin(Command{Type: QuoteCommand, Account: maker, Quote: quote}); err != nil {
+		return nil, err
+	}
+	defer m.end()
+
+	if err := quote.validate(); err != nil {
+		m.reject(&Order{ID: quoteOrderID(maker, Buy), Account: maker, Kind: Buy, Volume: quote.BidVolume, Price: quote.BidPrice}, err)
+		return nil, m.reject(&Order{ID: quoteOrderID(maker, Sell), Account: maker, Kind: Sell, Volume: quote.AskVolume, Price: quote.AskPrice}, err)
+	}
+
+	if m.batch {
+		return nil, errBatchMode
+	}
+
+	defer m.notify()
+	return m.requote(maker, quote), nil
+}
+
+// requote applies a valid quote. Sides to replace are all removed before new ones are added, so the new quote can't
+// trade with the old one. A replaced side is reported as amended rather than as a cancel followed by a new order.
+func (m *Market) requote(maker string, quote Quote) []*Order {
+	sides := []struct {
+		kind          Kind
+		volume, price Decimal
+		replace       bool
+		amend         bool
+	}{
+		{kind: Buy, volume: quote.BidVolume, price: quote.BidPrice},
+		{kind: Sell, volume: quote.AskVolume, price: quote.AskPrice},
+	}
+
+	for i, side := range sides {
+		if m.halted {
+			return nil
+		}
+
+		e, ok := m.orders[quoteOrderID(maker, side.kind)]
+		if !ok {
+			sides[i].replace = side.volume.Sign() > 0
+			continue
+		}
+
+		old := e.Order
+		if side.volume.Sign() > 0 && old.Price.Equal(side.price) && side.volume.LessThanOrEqual(old.Volume) {
+			if !side.volume.Equal(old.Volume) {
+				updated := *old
+				updated.Volume = side.volume
+				m.broker(side.kind).Update(e, &updated)
+				m.emit(Amended, updated, nil, "")
+			}
+			continue
+		}
+
+		m.removeOrder(old.ID)
+		if side.volume.Sign() <= 0 {
+			m.emit(Cancelled, *old, nil, "")
+			continue
+		}
+		sides[i].replace, sides[i].amend = true, true
+	}
+
+	var done []*Order
+	for _, side := range sides {
+		if !side.replace || m.halted {
+			continue
+		}
+
+		order := &Order{ID: quoteOrderID(maker, side.kind), Account: maker, Kind: side.kind, Volume: side.volume, Price: side.price}
+		if side.amend {
+			m.emit(Amended, *order, nil, "")
+		} else {
+			m.emit(Accepted, *order, nil, "")
+		}
+
+		sideDone, _, _, _ := m.process(order)
+		done = append(done, sideDone...)
+	}
+
+	return done
+}
@@ -0,0 +1,123 @@
+package market
+
+import (
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	var rejected []Event
+	market := NewMarket(WithListener(ListenerFunc(func(event Event) {
+		if event.Type == Rejected {
+			rejected = append(rejected, event)
+		}
+	})))
+
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(5), NewDecimalValue(99)); err != nil {
+		t.Fatal(err)
+	}
+
+	quote := Quote{BidPrice: NewDecimalValue(99), BidVolume: NewDecimalValue(10), AskPrice: NewDecimalValue(101), AskVolume: NewDecimalValue(10)}
+	if _, err := market.Quote("maker", quote); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := market.Quote("maker", Quote{BidPrice: NewDecimalValue(102), BidVolume: NewDecimalValue(1), AskPrice: NewDecimalValue(101), AskVolume: NewDecimalValue(1)}); err == nil {
+		t.Fatal("should not be possible to quote a crossed market")
+	}
+	if len(rejected) != 2 || rejected[0].Order.ID != "maker/bid" || rejected[1].Order.ID != "maker/ask" {
+		t.Fatal("both sides of an invalid quote should be rejected", rejected)
+	}
+
+	current, ok := market.QuoteOf("maker")
+	if !ok || !current.BidVolume.Equal(NewDecimalValue(10)) || !current.AskPrice.Equal(NewDecimalValue(101)) {
+		t.Fatal("invalid quote", current)
+	}
+
+	// smaller bid at the same price keeps its place behind buy-1, the ask moves
+	quote.BidVolume = NewDecimalValue(4)
+	quote.AskPrice = NewDecimalValue(100)
+	bid := market.orders["maker/bid"]
+	if _, err := market.Quote("maker", quote); err != nil {
+		t.Fatal(err)
+	}
+
+	if market.orders["maker/bid"] != bid || !bid.Order.Volume.Equal(NewDecimalValue(4)) || market.buys.MaxPriceQueue().Tail() != bid {
+		t.Fatal("reduced side should be updated in place")
+	}
+
+	if !market.buys.Volume.Equal(NewDecimalValue(9)) {
+		t.Fatal("invalid bids volume", market.buys.Volume)
+	}
+
+	if !market.Order("maker/ask").Price.Equal(NewDecimalValue(100)) {
+		t.Fatal("ask should be replaced")
+	}
+
+	// dropping a side removes it
+	if _, err := market.Quote("maker", Quote{AskPrice: NewDecimalValue(100), AskVolume: NewDecimalValue(10)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if market.Order("maker/bid") != nil || market.Order("maker/ask") == nil {
+		t.Fatal("quote should have only the ask")
+	}
+}
+
+func TestMassQuote(t *testing.T) {
+	exchange := NewExchange()
+	for _, symbol := range []string{"AAA", "BBB"} {
+		if _, err := exchange.AddMarket(symbol); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := exchange.AddMarket("AAA"); err == nil {
+		t.Fatal("should not be possible to add an existing market")
+	}
+
+	if _, _, _, err := exchange.Market("BBB").ProcessSellOrder("sell-1", NewDecimalValue(2), NewDecimalValue(50)); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []Quote{
+		{Symbol: "AAA", BidPrice: NewDecimalValue(10), BidVolume: NewDecimalValue(1), AskPrice: NewDecimalValue(11), AskVolume: NewDecimalValue(1)},
+		{Symbol: "CCC", BidPrice: NewDecimalValue(10), BidVolume: NewDecimalValue(1)},
+	}
+	if _, err := exchange.MassQuote("maker", invalid); err == nil {
+		t.Fatal("should not be possible to quote an unknown market")
+	}
+
+	if _, ok := exchange.Market("AAA").QuoteOf("maker"); ok {
+		t.Fatal("invalid mass quote should change nothing")
+	}
+
+	// a market refusing commands fails the mass quote before any market is requoted
+	exchange.Market("BBB").readOnly = true
+	if _, err := exchange.MassQuote("maker", []Quote{
+		{Symbol: "AAA", BidPrice: NewDecimalValue(10), BidVolume: NewDecimalValue(1)},
+		{Symbol: "BBB", BidPrice: NewDecimalValue(50), BidVolume: NewDecimalValue(1)},
+	}); err == nil {
+		t.Fatal("should not be possible to quote a market refusing commands")
+	}
+	if _, ok := exchange.Market("AAA").QuoteOf("maker"); ok {
+		t.Fatal("refused mass quote should change nothing")
+	}
+	exchange.Market("BBB").readOnly = false
+
+	done, err := exchange.MassQuote("maker", []Quote{
+		{Symbol: "AAA", BidPrice: NewDecimalValue(10), BidVolume: NewDecimalValue(1), AskPrice: NewDecimalValue(11), AskVolume: NewDecimalValue(1)},
+		{Symbol: "BBB", BidPrice: NewDecimalValue(50), BidVolume: NewDecimalValue(3), AskPrice: NewDecimalValue(52), AskVolume: NewDecimalValue(3)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(done) != 2 || len(done[0]) != 0 || len(done[1]) != 1 || done[1][0].ID != "sell-1" {
+		t.Fatal("crossing quote should trade", done)
+	}
+
+	quote, ok := exchange.Market("BBB").QuoteOf("maker")
+	if !ok || !quote.BidVolume.Equal(NewDecimalValue(1)) || !quote.AskVolume.Equal(NewDecimalValue(3)) {
+		t.Fatal("invalid quote left", quote)
+	}
+}
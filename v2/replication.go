@@ -0,0 +1,395 @@
+package market
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type frameType uint8
+
+const (
+	commandFrame  frameType = iota + 1 // a journaled command of a market
+	checksumFrame                      // command count and book checksum of a market, compared by the follower
+)
+
+type ackStatus uint8
+
+const (
+	ackApplied  ackStatus = iota
+	ackMismatch           // the follower book is not the one of the primary
+	ackFailed             // the follower could not apply the frame and stopped
+)
+
+// ackSize is the size of an acknowledgement : the sequence number of the frame and its status
+const ackSize = 9
+
+// Primary streams the journal of its markets to a follower. Frames are numbered in the order they are sent and the
+// follower acknowledges each one once applied. A synchronous primary waits for the acknowledgement before a command
+// takes effect, so a promoted follower has every confirmed order, and journals it locally only once acknowledged, so
+// a failed command is not recovered. When the follower fails or doesn't answer in time, the journals break and the
+// markets refuse commands : the command which failed is in doubt, the follower may still apply it.
+type Primary struct {
+	Timeout time.Duration // how long a command waits for the follower, zero waits until the connection fails
+
+	conn        net.Conn
+	synchronous bool
+
+	writing sync.Mutex // frames are written whole and in sequence order
+	sent    atomic.Uint64
+
+	mu         sync.Mutex
+	acked      uint64
+	mismatches map[uint64]bool
+	err        error
+	changed    chan struct{} // closed when acked or err change
+}
+
+// NewPrimary streams to the follower connected by conn
+func NewPrimary(conn net.Conn, synchronous bool) *Primary {
+	result := &Primary{conn: conn, synchronous: synchronous, mismatches: map[uint64]bool{}, changed: make(chan struct{})}
+	go result.receive()
+	return result
+}
+
+// Journal returns the journal of the market named symbol : commands are written to w, if not nil, then streamed to
+// the follower, which must hold a market of that symbol in the same state.
+func (p *Primary) Journal(symbol string, w io.Writer) *Journal {
+	return NewJournal(&replica{primary: p, symbol: symbol, w: w})
+}
+
+// Acked returns the sequence number of the last frame acknowledged by the follower
+func (p *Primary) Acked() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.acked
+}
+
+// Sync waits for the follower to acknowledge every frame sent so far
+func (p *Primary) Sync() error {
+	return p.wait(p.sent.Load())
+}
+
+// Verify sends the book checksum of the market named symbol and waits for the follower to compare it with its own
+func (p *Primary) Verify(symbol string, market *Market) error {
+	e := encoder{}
+	e.uint(market.commands)
+	e.uint(uint64(market.Checksum()))
+
+	seq, err := p.send(checksumFrame, symbol, e.buf)
+	if err != nil {
+		return err
+	}
+
+	if err := p.wait(seq); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.mismatches[seq] {
+		delete(p.mismatches, seq)
+		return errors.New("follower book checksum differs")
+	}
+	return nil
+}
+
+// Close closes the connection to the follower
+func (p *Primary) Close() error {
+	return p.conn.Close()
+}
+
+func (p *Primary) send(kind frameType, symbol string, body []byte) (uint64, error) {
+	e := encoder{buf: make([]byte, recordHeader, recordHeader+len(symbol)+len(body)+8)}
+	e.uint(uint64(kind))
+	e.string(symbol)
+	e.buf = append(e.buf, body...)
+	seal(e.buf)
+
+	p.writing.Lock()
+	defer p.writing.Unlock()
+
+	if err := p.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := p.conn.Write(e.buf); err != nil {
+		p.fail(err)
+		return 0, err
+	}
+
+	return p.sent.Add(1), nil
+}
+
+// Err returns the error which stopped the replication, if any
+func (p *Primary) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
+
+func (p *Primary) receive() {
+	ack := make([]byte, ackSize)
+	for {
+		if _, err := io.ReadFull(p.conn, ack); err != nil {
+			p.fail(err)
+			return
+		}
+
+		seq := binary.BigEndian.Uint64(ack)
+		p.mu.Lock()
+		switch ackStatus(ack[8]) {
+		case ackMismatch:
+			p.mismatches[seq] = true
+		case ackFailed:
+			p.err = errors.New("follower failed to apply the journal stream")
+		}
+		p.acked = seq
+		p.broadcast()
+		p.mu.Unlock()
+	}
+}
+
+func (p *Primary) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err == nil {
+		p.err = err
+	}
+	p.broadcast()
+}
+
+// broadcast wakes the waiting commands up. The caller holds mu.
+func (p *Primary) broadcast() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// wait blocks until the follower acknowledges the frame seq
+func (p *Primary) wait(seq uint64) error {
+	var timeout <-chan time.Time
+	if p.Timeout > 0 {
+		timer := time.NewTimer(p.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.acked < seq {
+		if p.err != nil {
+			return p.err
+		}
+
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+			p.mu.Lock()
+		case <-timeout:
+			p.mu.Lock()
+			return errors.New("follower acknowledgement timed out")
+		}
+	}
+
+	return nil
+}
+
+// replica is the journal writer of a market of a Primary. Journal writes each record at once.
+type replica struct {
+	primary *Primary
+	symbol  string
+	w       io.Writer
+	last    uint64 // frame of the last record
+	pending []byte // last record of a synchronous primary, written locally once acknowledged
+}
+
+func (r *replica) Write(record []byte) (int, error) {
+	if r.primary.synchronous {
+		r.pending = append(r.pending[:0], record...)
+	} else if err := r.write(record); err != nil {
+		return 0, err
+	}
+
+	seq, err := r.primary.send(commandFrame, r.symbol, record[recordHeader:])
+	if err != nil {
+		return 0, err
+	}
+
+	r.last = seq
+	return len(record), nil
+}
+
+// Sync waits for the follower if the primary is synchronous and writes the acknowledged record, then syncs the local
+// journal
+func (r *replica) Sync() error {
+	if r.primary.synchronous {
+		if err := r.primary.wait(r.last); err != nil {
+			return err
+		}
+
+		err := r.write(r.pending)
+		r.pending = r.pending[:0]
+		if err != nil {
+			return err
+		}
+	}
+
+	if syncer, ok := r.w.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// write writes a record to the local journal, if any
+func (r *replica) write(record []byte) error {
+	if r.w == nil {
+		return nil
+	}
+
+	_, err := r.w.Write(record)
+	return err
+}
+
+func (r *replica) Close() error {
+	if closer, ok := r.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Follower applies the journal stream of a Primary to the markets of its exchange, by symbol, and acknowledges each
+// frame. The markets must be in the state of the primary ones when the stream starts, and must take no other command
+// until the follower is promoted.
+type Follower struct {
+	conn     net.Conn
+	exchange *Exchange
+	applied  atomic.Uint64
+	done     chan struct{}
+	err      error // set before done is closed
+}
+
+// NewFollower follows the primary connected by conn
+func NewFollower(conn net.Conn, exchange *Exchange) *Follower {
+	result := &Follower{conn: conn, exchange: exchange, done: make(chan struct{})}
+	go result.run()
+	return result
+}
+
+// Applied returns the sequence number of the last frame applied
+func (f *Follower) Applied() uint64 {
+	return f.applied.Load()
+}
+
+// Done is closed when the stream stops, most likely because the primary is gone
+func (f *Follower) Done() <-chan struct{} {
+	return f.done
+}
+
+// Promote stops following, so the markets of the exchange take commands as the new primary ones. The error is the
+// one which stopped the stream before, if any : the markets of a follower which failed to apply it are behind.
+func (f *Follower) Promote() (*Exchange, error) {
+	f.conn.Close()
+	<-f.done
+	for _, market := range f.exchange.markets {
+		market.settle()
+	}
+	return f.exchange, f.err
+}
+
+func (f *Follower) run() {
+	defer close(f.done)
+
+	r := bufio.NewReader(f.conn)
+	for seq := uint64(1); ; seq++ {
+		payload, err := readFrame(r)
+		if err != nil {
+			// a closed connection is a primary gone or a promotion, not a failure of the follower
+			if errors.Is(err, errCorrupted) {
+				f.err = err
+			}
+			return
+		}
+
+		status, err := f.apply(payload)
+		if err != nil {
+			f.err, status = err, ackFailed
+		}
+
+		ack := binary.BigEndian.AppendUint64(make([]byte, 0, ackSize), seq)
+		if _, err := f.conn.Write(append(ack, byte(status))); err != nil || status == ackFailed {
+			f.conn.Close()
+			return
+		}
+		f.applied.Store(seq)
+	}
+}
+
+func (f *Follower) apply(payload []byte) (ackStatus, error) {
+	d := decoder{buf: payload}
+	kind := frameType(d.uint())
+	symbol := d.string()
+	if d.err != nil {
+		return ackFailed, d.err
+	}
+
+	market := f.exchange.Market(symbol)
+	if market == nil {
+		return ackFailed, errors.New("unknown market " + symbol)
+	}
+
+	switch kind {
+	case commandFrame:
+		var command Command
+		command.decode(&d)
+		if d.err != nil {
+			return ackFailed, d.err
+		}
+		return ackApplied, market.Apply(command)
+	case checksumFrame:
+		commands, checksum := d.uint(), d.uint()
+		if d.err != nil {
+			return ackFailed, d.err
+		}
+		market.settle()
+		if market.commands != commands || uint64(market.Checksum()) != checksum {
+			return ackMismatch, nil
+		}
+		return ackApplied, nil
+	default:
+		return ackFailed, errors.New("unknown replication frame")
+	}
+}
+
+// readFrame reads a frame of the stream, sealed like journal records
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, recordHeader)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	size, err := recordSize(header)
+	if err != nil {
+		return nil, errCorrupted
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if !checkPayload(header, payload) {
+		return nil, errCorrupted
+	}
+	return payload, nil
+}
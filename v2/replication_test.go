@@ -0,0 +1,155 @@
+package market
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// connect returns both ends of a local TCP connection
+func connect(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, _ := listener.Accept()
+		accepted <- conn
+	}()
+
+	dialed, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := <-accepted
+	if conn == nil {
+		t.Fatal("connection not accepted")
+	}
+	return conn, dialed
+}
+
+func TestReplication(t *testing.T) {
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		engineTime = engineTime.Add(time.Millisecond)
+		return engineTime
+	}
+
+	primaryConn, followerConn := connect(t)
+	primary := NewPrimary(primaryConn, true)
+	primary.Timeout = 5 * time.Second
+	defer primary.Close()
+
+	exchange := NewExchange()
+	market, err := exchange.AddMarket("BTC", WithClock(clock), WithPriorityShare(decimalFromParts(5, -1)), WithJournal(primary.Journal("BTC", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	standby := NewExchange()
+	// the follower clock is never read : replicated commands keep the primary time
+	if _, err := standby.AddMarket("BTC", WithPriorityShare(decimalFromParts(5, -1))); err != nil {
+		t.Fatal(err)
+	}
+	follower := NewFollower(followerConn, standby)
+
+	runCommands(t, market)
+	if primary.Acked() != market.commands {
+		t.Fatal("synchronous commands should be acknowledged", primary.Acked(), market.commands)
+	}
+
+	if err := primary.Verify("BTC", market); err != nil {
+		t.Fatal(err)
+	}
+
+	promoted, err := follower.Promote()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if follower.Applied() != market.commands+1 {
+		t.Fatal("invalid applied frames", follower.Applied())
+	}
+
+	standbyMarket := promoted.Market("BTC")
+	if standbyMarket.Checksum() != market.Checksum() || standbyMarket.Seq() != market.Seq() || promoted.Seq() != exchange.Seq() {
+		t.Fatal("promoted market differs from the primary one")
+	}
+
+	// the promoted market takes orders, the primary without its follower doesn't
+	if _, _, _, err := standbyMarket.ProcessBuyOrder("buy-promoted", NewDecimalValue(1), NewDecimalValue(90)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessBuyOrder("buy-primary", NewDecimalValue(1), NewDecimalValue(90)); err == nil {
+		t.Fatal("synchronous primary should refuse orders without follower")
+	}
+}
+
+func TestReplicationMismatch(t *testing.T) {
+	primaryConn, followerConn := connect(t)
+	primary := NewPrimary(primaryConn, false)
+	defer primary.Close()
+
+	market := NewMarket(WithJournal(primary.Journal("BTC", nil)))
+
+	standby := NewExchange()
+	standbyMarket, err := standby.AddMarket("BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the follower doesn't start from the primary state
+	standbyMarket.lastTradeID = 7
+	follower := NewFollower(followerConn, standby)
+
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(5), NewDecimalValue(101)); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := primary.Verify("BTC", market); err == nil {
+		t.Fatal("diverging books should be detected")
+	}
+
+	if _, err := follower.Promote(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplicationTimeout(t *testing.T) {
+	primaryConn, followerConn := connect(t)
+	defer followerConn.Close()
+	primary := NewPrimary(primaryConn, true)
+	primary.Timeout = 50 * time.Millisecond
+	defer primary.Close()
+
+	path := filepath.Join(t.TempDir(), "BTC.journal")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// nobody acknowledges on the follower end : the order is in doubt, not journaled locally
+	market := NewMarket(WithJournal(primary.Journal("BTC", file)))
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(5), NewDecimalValue(101)); err == nil {
+		t.Fatal("order should fail without acknowledgement")
+	}
+
+	recovered, err := Replay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered.Commands() != 0 || recovered.Order("sell-1") != nil {
+		t.Fatal("unacknowledged command should not be journaled locally")
+	}
+}
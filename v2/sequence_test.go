@@ -0,0 +1,69 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSequence(t *testing.T) {
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return engineTime }
+
+	var events []Event
+	listener := ListenerFunc(func(event Event) { events = append(events, event) })
+
+	exchange := NewExchange()
+	first, err := exchange.AddMarket("AAA", WithClock(clock), WithListener(listener))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := exchange.AddMarket("BBB", WithClock(clock), WithListener(listener))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := first.ProcessSellOrder("sell-1", NewDecimalValue(2), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := second.ProcessSellOrder("sell-1", NewDecimalValue(2), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := first.ProcessSellOrder("sell-2", NewDecimalValue(2), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ seq, globalSeq uint64 }{{1, 1}, {2, 2}, {1, 3}, {2, 4}, {3, 5}, {4, 6}}
+	if len(events) != len(expected) {
+		t.Fatal("invalid events count", len(events))
+	}
+	for i, event := range events {
+		if event.Seq != expected[i].seq || event.GlobalSeq != expected[i].globalSeq || !event.Time.Equal(engineTime) {
+			t.Fatalf("invalid event %d sequence : %d %d", i, event.Seq, event.GlobalSeq)
+		}
+	}
+
+	if first.Seq() != 4 || second.Seq() != 2 || exchange.Seq() != 6 {
+		t.Fatal("invalid last sequence numbers")
+	}
+
+	// resting orders are prioritized by the sequence of their Rested event
+	if first.Order("sell-1").Seq != 2 || first.Order("sell-2").Seq != 4 || !first.Order("sell-1").Time.Equal(engineTime) {
+		t.Fatal("invalid resting orders sequence")
+	}
+
+	// growing an order sends it to the back of the queue, with a new sequence
+	if _, err := first.AmendOrder("sell-1", NewDecimalValue(3), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	if first.Order("sell-1").Seq != 6 || first.sales.MinPriceQueue().Head().Order.ID != "sell-2" {
+		t.Fatal("amended order should lose its priority")
+	}
+
+	trades, err := first.PlaceOrder(NewBuy("buy-1", NewDecimalValue(1), NewDecimalValue(100), time.Time{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 1 || trades[0].MakerOrderID != "sell-2" || !trades[0].Time.Equal(engineTime) {
+		t.Fatal("invalid trade", trades)
+	}
+}
@@ -0,0 +1,259 @@
+package market
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"sort"
+)
+
+// snapshotVersion is the version of the snapshot encodings, binary and JSON
+const snapshotVersion = 1
+
+var snapshotMagic = []byte("MEV2")
+
+// SnapshotLevel is a price level of a snapshot, with its orders in queue order : displayed ones, then hidden ones
+type SnapshotLevel struct {
+	Price        Decimal
+	Volume       Decimal
+	HiddenVolume Decimal
+	Orders       []Order
+}
+
+// BrokerSnapshot is a side of the book, levels from the lowest price, along with the Broker aggregates
+type BrokerSnapshot struct {
+	Volume       Decimal
+	HiddenVolume Decimal
+	Len          int
+	Depth        int
+	Levels       []SnapshotLevel
+}
+
+// MarketSnapshot is the full state of a Market : every resting order in its queue position, the aggregates of the
+// book and the engine counters. Options, such as the allocator or the clock, are not part of it.
+type MarketSnapshot struct {
+	Seq         uint64
+	Commands    uint64 // sequence number of the last command, the journal goes on after it
+	LastTradeID uint64
+	Priorities  map[string]Priority
+	Buys        BrokerSnapshot
+	Sales       BrokerSnapshot
+}
+
+// Snapshot captures the state of the market
+func (m *Market) Snapshot() *MarketSnapshot {
+	result := &MarketSnapshot{
+		Seq:         m.seq,
+		Commands:    m.commands,
+		LastTradeID: m.lastTradeID,
+		Priorities:  map[string]Priority{},
+		Buys:        snapshotOf(m.buys),
+		Sales:       snapshotOf(m.sales),
+	}
+
+	for account, priority := range m.priorities {
+		result.Priorities[account] = priority
+	}
+
+	return result
+}
+
+// Checksum is the CRC-32C checksum of the binary snapshot of the market : markets in the same state have the same
+// checksum.
+func (m *Market) Checksum() uint32 {
+	data, _ := m.Snapshot().MarshalBinary()
+	return binary.BigEndian.Uint32(data[len(data)-4:])
+}
+
+func snapshotOf(broker *Broker) BrokerSnapshot {
+	result := BrokerSnapshot{Volume: broker.Volume, HiddenVolume: broker.HiddenVolume, Len: broker.Len, Depth: broker.Depth}
+
+	for level := broker.MinPriceQueue(); level != nil; level = broker.GreaterThan(level.Price) {
+		snapshot := SnapshotLevel{Price: level.Price, Volume: level.Volume, HiddenVolume: level.HiddenVolume}
+		for e := level.Head(); e != nil; e = level.Next(e) {
+			snapshot.Orders = append(snapshot.Orders, *e.Order)
+		}
+		result.Levels = append(result.Levels, snapshot)
+	}
+
+	return result
+}
+
+// RestoreMarket rebuilds a market from a snapshot, so matching continues as if it never stopped.
+// The snapshot aggregates must match its orders.
+func RestoreMarket(snapshot *MarketSnapshot, options ...Option) (*Market, error) {
+	result := NewMarket(options...)
+	result.seq = snapshot.Seq
+	result.commands = snapshot.Commands
+	result.lastTradeID = snapshot.LastTradeID
+	for account, priority := range snapshot.Priorities {
+		result.priorities[account] = priority
+	}
+
+	for _, side := range []struct {
+		broker   *Broker
+		snapshot BrokerSnapshot
+	}{{result.buys, snapshot.Buys}, {result.sales, snapshot.Sales}} {
+		for _, level := range side.snapshot.Levels {
+			for i := range level.Orders {
+				order := level.Orders[i]
+				if _, ok := result.orders[order.ID]; ok || !order.Price.Equal(level.Price) {
+					return nil, errors.New("invalid snapshot order " + order.ID)
+				}
+				result.orders[order.ID] = side.broker.Add(&order)
+			}
+
+			queue := side.broker.Level(level.Price)
+			if queue == nil || !queue.Volume.Equal(level.Volume) || !queue.HiddenVolume.Equal(level.HiddenVolume) {
+				return nil, errors.New("snapshot level aggregates don't match its orders")
+			}
+		}
+
+		broker := side.broker
+		if !broker.Volume.Equal(side.snapshot.Volume) || !broker.HiddenVolume.Equal(side.snapshot.HiddenVolume) ||
+			broker.Len != side.snapshot.Len || broker.Depth != side.snapshot.Depth {
+			return nil, errors.New("snapshot aggregates don't match its orders")
+		}
+	}
+
+	return result, nil
+}
+
+// MarshalBinary encodes the snapshot as its magic, version, content and CRC-32C checksum
+func (s *MarketSnapshot) MarshalBinary() ([]byte, error) {
+	e := encoder{buf: append([]byte(nil), snapshotMagic...)}
+	e.buf = binary.BigEndian.AppendUint16(e.buf, snapshotVersion)
+
+	e.uint(s.Seq)
+	e.uint(s.Commands)
+	e.uint(s.LastTradeID)
+
+	accounts := make([]string, 0, len(s.Priorities))
+	for account := range s.Priorities {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	e.uint(uint64(len(accounts)))
+	for _, account := range accounts {
+		e.string(account)
+		e.uint(uint64(s.Priorities[account]))
+	}
+
+	for _, broker := range []*BrokerSnapshot{&s.Buys, &s.Sales} {
+		e.decimal(broker.Volume)
+		e.decimal(broker.HiddenVolume)
+		e.uint(uint64(broker.Len))
+		e.uint(uint64(broker.Depth))
+		e.uint(uint64(len(broker.Levels)))
+		for _, level := range broker.Levels {
+			e.decimal(level.Price)
+			e.decimal(level.Volume)
+			e.decimal(level.HiddenVolume)
+			e.uint(uint64(len(level.Orders)))
+			for i := range level.Orders {
+				e.order(&level.Orders[i])
+			}
+		}
+	}
+
+	e.buf = binary.BigEndian.AppendUint32(e.buf, crc32.Checksum(e.buf, crcTable))
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a snapshot written by MarshalBinary, checking its version and checksum
+func (s *MarketSnapshot) UnmarshalBinary(data []byte) error {
+	header := len(snapshotMagic) + 2
+	if len(data) < header+4 || !bytes.Equal(data[:len(snapshotMagic)], snapshotMagic) {
+		return errors.New("not a market snapshot")
+	}
+
+	if version := binary.BigEndian.Uint16(data[len(snapshotMagic):]); version != snapshotVersion {
+		return errors.New("unsupported snapshot version")
+	}
+
+	content := data[:len(data)-4]
+	if crc32.Checksum(content, crcTable) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return errors.New("snapshot checksum mismatch")
+	}
+
+	d := decoder{buf: content[header:]}
+	result := MarketSnapshot{Seq: d.uint(), Commands: d.uint(), LastTradeID: d.uint(), Priorities: map[string]Priority{}}
+
+	for i, count := uint64(0), d.uint(); i < count && d.err == nil; i++ {
+		account := d.string()
+		result.Priorities[account] = Priority(d.uint())
+	}
+
+	for _, broker := range []*BrokerSnapshot{&result.Buys, &result.Sales} {
+		broker.Volume = d.decimal()
+		broker.HiddenVolume = d.decimal()
+		broker.Len = int(d.uint())
+		broker.Depth = int(d.uint())
+		for i, count := uint64(0), d.uint(); i < count && d.err == nil; i++ {
+			level := SnapshotLevel{Price: d.decimal(), Volume: d.decimal(), HiddenVolume: d.decimal()}
+			for j, orders := uint64(0), d.uint(); j < orders && d.err == nil; j++ {
+				level.Orders = append(level.Orders, *d.order())
+			}
+			broker.Levels = append(broker.Levels, level)
+		}
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+
+	if len(d.buf) > 0 {
+		return errCorrupted
+	}
+
+	*s = result
+	return nil
+}
+
+// snapshotJSON is the JSON debug form of a snapshot. Checksum is the CRC-32C of the market, as written.
+type snapshotJSON struct {
+	Version  int             `json:"version"`
+	Checksum uint32          `json:"checksum"`
+	Market   json.RawMessage `json:"market"`
+}
+
+// JSON encodes the snapshot in the readable debug format, versioned and checksummed like the binary one
+func (s *MarketSnapshot) JSON() ([]byte, error) {
+	market, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(snapshotJSON{Version: snapshotVersion, Checksum: crc32.Checksum(market, crcTable), Market: market}, "", "  ")
+}
+
+// ParseSnapshotJSON decodes a snapshot written by JSON, checking its version and checksum
+func ParseSnapshotJSON(data []byte) (*MarketSnapshot, error) {
+	var file snapshotJSON
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	if file.Version != snapshotVersion {
+		return nil, errors.New("unsupported snapshot version")
+	}
+
+	var market bytes.Buffer
+	if err := json.Compact(&market, file.Market); err != nil {
+		return nil, err
+	}
+
+	if crc32.Checksum(market.Bytes(), crcTable) != file.Checksum {
+		return nil, errors.New("snapshot checksum mismatch")
+	}
+
+	result := &MarketSnapshot{}
+	if err := json.Unmarshal(market.Bytes(), result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package market
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return engineTime }
+
+	var events []Event
+	options := []Option{WithClock(clock), WithPriorityShare(decimalFromParts(5, -1))}
+	market := NewMarket(append(options, WithListener(ListenerFunc(func(event Event) { events = append(events, event) })))...)
+	runCommands(t, market)
+	if _, _, _, err := market.ProcessOrder(&Order{ID: "buy-hidden", Kind: Buy, Volume: NewDecimalValue(2), Price: NewDecimalValue(99), Hidden: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := market.Snapshot()
+
+	data, err := snapshot.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded MarketSnapshot
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snapshot.Buys.Levels[0].Orders, decoded.Buys.Levels[0].Orders) || decoded.Seq != market.Seq() {
+		t.Fatal("invalid decoded snapshot")
+	}
+
+	data[len(data)/2] ^= 0xff
+	if err := decoded.UnmarshalBinary(data); err == nil {
+		t.Fatal("corrupted snapshot should be detected")
+	}
+
+	text, err := snapshot.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromJSON, err := ParseSnapshotJSON(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, restore := range []*MarketSnapshot{snapshot, fromJSON} {
+		var restoredEvents []Event
+		restored, err := RestoreMarket(restore, append(options, WithListener(ListenerFunc(func(event Event) { restoredEvents = append(restoredEvents, event) })))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		asks, bids := market.DepthTop(0)
+		restoredAsks, restoredBids := restored.DepthTop(0)
+		if !reflect.DeepEqual(bids, restoredBids) || !reflect.DeepEqual(asks, restoredAsks) {
+			t.Fatal("restored depth differs")
+		}
+
+		// both markets match the same way afterwards
+		events = nil
+		for _, m := range []*Market{market, restored} {
+			if _, _, _, err := m.ProcessSellOrder("sell-after", NewDecimalValue(10), NewDecimalValue(90)); err != nil {
+				t.Fatal(err)
+			}
+			m.CancelOrder("sell-after")
+		}
+
+		if len(events) == 0 || len(events) != len(restoredEvents) {
+			t.Fatal("invalid restored events count", len(events), len(restoredEvents))
+		}
+		for i := range events {
+			if events[i].Seq != restoredEvents[i].Seq || events[i].Type != restoredEvents[i].Type || events[i].Order.ID != restoredEvents[i].Order.ID ||
+				!events[i].Order.Volume.Equal(restoredEvents[i].Order.Volume) || (events[i].Trade == nil) != (restoredEvents[i].Trade == nil) {
+				t.Fatalf("restored event %d differs :\n%v\n%v", i, events[i], restoredEvents[i])
+			}
+			if events[i].Trade != nil && (events[i].Trade.ID != restoredEvents[i].Trade.ID || !events[i].Trade.Price.Equal(restoredEvents[i].Trade.Price)) {
+				t.Fatalf("restored trade %d differs :\n%v\n%v", i, events[i].Trade, restoredEvents[i].Trade)
+			}
+		}
+
+		// start again from the snapshot state
+		market, err = RestoreMarket(snapshot, append(options, WithListener(ListenerFunc(func(event Event) { events = append(events, event) })))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	broken := market.Snapshot()
+	broken.Sales.Levels[0].Volume = NewDecimalValue(1000)
+	if _, err := RestoreMarket(broken); err == nil {
+		t.Fatal("inconsistent snapshot should not be restored")
+	}
+}
@@ -0,0 +1,292 @@
+package market
+
+import (
+	"errors"
+	"time"
+)
+
+// SpreadFill is an execution of a spread order, either against another spread order or against implied liquidity
+type SpreadFill struct {
+	OrderID    string  // resting spread order, empty for implied executions
+	Price      Decimal // spread price
+	Volume     Decimal
+	FrontPrice Decimal  // front leg price, implied executions only
+	BackPrice  Decimal  // back leg price, implied executions only
+	Legs       []*Trade // outright trades of both legs, implied executions only
+	Implied    bool
+}
+
+// Spread is a calendar spread instrument linking two outright markets. Buying the spread buys the front market and
+// sells the back one, at the price difference between them, so spread prices can be zero or negative.
+// Spread orders match other spread orders in the spread book, or the implied liquidity built from the best prices of
+// the two legs : an implied execution fills both legs in their outright books, or none of them. A spread order is a
+// command of the spread book taken after its implied executions, so only the spread book failing to journal it right
+// then leaves them without the order.
+type Spread struct {
+	front *Market
+	back  *Market
+	book  *Market // spread orders
+}
+
+// NewSpread links the front and back markets, options being the ones of the spread book : its journal, listeners
+// and clock see the spread orders
+func NewSpread(front, back *Market, options ...Option) *Spread {
+	return &Spread{
+		front: front,
+		back:  back,
+		book:  NewMarket(options...),
+	}
+}
+
+func (s *Spread) Order(orderID string) *Order {
+	return s.book.Order(orderID)
+}
+
+func (s *Spread) CancelOrder(orderID string) *Order {
+	return s.book.CancelOrder(orderID)
+}
+
+// Depth returns price levels and volumes of spread orders, implied liquidity excluded
+func (s *Spread) Depth() ([]PriceVolume, []PriceVolume) {
+	return s.book.Depth()
+}
+
+// Implied returns the implied price and volume a spread order of kind could execute against
+func (s *Spread) Implied(kind Kind) (Decimal, Decimal, bool) {
+	front, back := s.impliedLegs(kind)
+	if front == nil || back == nil {
+		return NewZeroDecimal(), NewZeroDecimal(), false
+	}
+
+	volume := decimalMin(front.Volume, back.Volume)
+	return front.Price.Sub(back.Price), volume, volume.Sign() > 0
+}
+
+// impliedLegs returns the best displayed outright levels a spread order of kind executes against : buying the spread
+// lifts the front ask and hits the back bid, selling it hits the front bid and lifts the back ask
+func (s *Spread) impliedLegs(kind Kind) (*OrderQueue, *OrderQueue) {
+	frontKind, backKind := Sell, Buy
+	if kind == Sell {
+		frontKind, backKind = Buy, Sell
+	}
+
+	var front, back *OrderQueue
+	s.front.walk(frontKind, func(level *OrderQueue) bool { front = level; return false })
+	s.back.walk(backKind, func(level *OrderQueue) bool { back = level; return false })
+	return front, back
+}
+
+// ProcessBuyOrder places new buy spread order
+//
+//	orderID - unique order ID
+//	volume - how much volume you want to buy
+//	price  - no more expensive this spread price
+//
+// Result : the executions of the order, implied ones first, and, if volume was left, the order resting in the spread
+// book
+func (s *Spread) ProcessBuyOrder(orderID string, volume, price Decimal) ([]SpreadFill, *Order, error) {
+	return s.process(NewBuy(orderID, volume, price, time.Time{}))
+}
+
+// ProcessSellOrder places new sell spread order
+//
+//	orderID - unique order ID
+//	volume - how much volume you want to sell
+//	price - no less cheap than this spread price
+//
+// Result : the executions of the order, implied ones first, and, if volume was left, the order resting in the spread
+// book
+func (s *Spread) ProcessSellOrder(orderID string, volume, price Decimal) ([]SpreadFill, *Order, error) {
+	return s.process(NewSell(orderID, volume, price, time.Time{}))
+}
+
+func (s *Spread) process(order *Order) ([]SpreadFill, *Order, error) {
+	if s.book.Order(order.ID) != nil {
+		return nil, nil, errors.New("order already exists")
+	}
+
+	if order.Volume.Sign() <= 0 {
+		return nil, nil, errors.New("invalid order volume")
+	}
+
+	if err := s.book.refuses(); err != nil {
+		return nil, nil, err
+	}
+
+	// implied liquidity executes first, walking the spread orders it competes with on price without touching them
+	var fills []SpreadFill
+	var legErr error
+	implied := NewZeroDecimal()
+	volumeLeft := order.Volume
+	outright := s.book.bestOpposite(order.Kind, order.Price)
+	outrightLeft := levelVolume(outright)
+	for volumeLeft.Sign() > 0 {
+		impliedPrice, impliedVolume, ok := s.Implied(order.Kind)
+		ok = ok && crosses(order.Kind, order.Price, impliedPrice)
+
+		// spread orders keep priority over implied liquidity at the same price
+		if outright != nil && (!ok || crosses(order.Kind, impliedPrice, outright.Price)) {
+			taken := decimalMin(volumeLeft, outrightLeft)
+			volumeLeft, outrightLeft = volumeLeft.Sub(taken), outrightLeft.Sub(taken)
+			if outrightLeft.Sign() <= 0 {
+				outright = s.book.nextOpposite(order, outright)
+				outrightLeft = levelVolume(outright)
+			}
+			continue
+		}
+
+		if !ok {
+			break
+		}
+
+		fill, err := s.executeLegs(order, decimalMin(volumeLeft, impliedVolume))
+		if err != nil {
+			legErr = err
+			break
+		}
+		fills = append(fills, fill)
+		implied = implied.Add(fill.Volume)
+		volumeLeft = volumeLeft.Sub(fill.Volume)
+	}
+
+	// legs failing end the order with what it got so far, nothing rests
+	placed := *order
+	if legErr != nil {
+		placed.Volume = order.Volume.Sub(volumeLeft)
+		if placed.Volume.Sign() <= 0 {
+			return nil, nil, legErr
+		}
+	}
+
+	trades, resting, err := s.book.placeSpread(&placed, implied)
+	if err != nil {
+		return fills, nil, err
+	}
+
+	for _, trade := range trades {
+		fills = append(fills, SpreadFill{OrderID: trade.MakerOrderID, Price: trade.Price, Volume: trade.Volume})
+	}
+	return fills, resting, legErr
+}
+
+// levelVolume returns the volume a level executes, hidden orders included
+func levelVolume(level *OrderQueue) Decimal {
+	if level == nil {
+		return NewZeroDecimal()
+	}
+	return level.Volume.Add(level.HiddenVolume)
+}
+
+// nextOpposite returns the opposite level after level an order of kind with price still executes against
+func (m *Market) nextOpposite(order *Order, level *OrderQueue) *OrderQueue {
+	next := m.buys.LessThan(level.Price)
+	if order.Kind == Buy {
+		next = m.sales.GreaterThan(level.Price)
+	}
+
+	if next != nil && crosses(order.Kind, order.Price, next.Price) {
+		return next
+	}
+	return nil
+}
+
+// placeSpread is the spread book command of a spread order, once implied executions filled implied of its volume :
+// the rest matches the resting spread orders and rests. Replaying it needs no leg markets.
+func (m *Market) placeSpread(order *Order, implied Decimal) ([]*Trade, *Order, error) {
+	if err := m.begin(Command{Type: SpreadCommand, Order: *order, Lot: implied}); err != nil {
+		return nil, nil, err
+	}
+	defer m.end()
+	defer m.notify()
+
+	m.emit(Accepted, *order, nil, "")
+
+	taker := *order
+	taker.Volume = order.Volume.Sub(implied)
+	processed := m.match(&taker)
+	if processed.VolumeLeft.Sign() <= 0 {
+		return processed.Trades, nil, nil
+	}
+
+	resting := *order
+	resting.Volume = processed.VolumeLeft
+	m.rest(&resting)
+	return processed.Trades, &resting, nil
+}
+
+// executeLegs fills volume of the spread order in both outright books at their best prices, with leg orders named after
+// it. Volume must not exceed the implied volume, which is what makes both legs execute entirely. Both legs are
+// journaled commands of their markets, journaled before either book changes : when the back one can't be, the front
+// one is voided and nothing executes.
+func (s *Spread) executeLegs(order *Order, volume Decimal) (SpreadFill, error) {
+	kind := order.Kind
+	front, back := s.impliedLegs(kind)
+	if front == nil || back == nil || volume.GreaterThan(front.Volume) || volume.GreaterThan(back.Volume) {
+		return SpreadFill{}, errors.New("implied volume is not available on both legs")
+	}
+
+	for _, market := range []*Market{s.front, s.back} {
+		if err := market.refuses(); err != nil {
+			return SpreadFill{}, err
+		}
+
+		if market.batch {
+			return SpreadFill{}, errBatchMode
+		}
+	}
+
+	frontPrice, backPrice := front.Price, back.Price
+	backKind := Sell
+	if kind == Sell {
+		backKind = Buy
+	}
+
+	frontOrder := &Order{ID: order.ID + "/front", Kind: kind, Volume: volume, Price: frontPrice}
+	backOrder := &Order{ID: order.ID + "/back", Kind: backKind, Volume: volume, Price: backPrice}
+
+	if err := s.front.begin(Command{Type: LegCommand, Order: *frontOrder}); err != nil {
+		return SpreadFill{}, err
+	}
+
+	if err := s.back.begin(Command{Type: LegCommand, Order: *backOrder}); err != nil {
+		s.front.end()
+		s.front.void()
+		return SpreadFill{}, err
+	}
+
+	frontTrades := s.front.executeLeg(frontOrder)
+	backTrades := s.back.executeLeg(backOrder)
+	return SpreadFill{
+		Price:      frontPrice.Sub(backPrice),
+		Volume:     volume,
+		FrontPrice: frontPrice,
+		BackPrice:  backPrice,
+		Legs:       append(frontTrades, backTrades...),
+		Implied:    true,
+	}, nil
+}
+
+// executeLeg matches a leg order of an implied spread execution, which never rests, within its begun command
+func (m *Market) executeLeg(order *Order) []*Trade {
+	defer m.end()
+	defer m.notify()
+
+	return m.match(order).Trades
+}
+
+// void journals that the leg command just journaled did not execute. When the journal fails again, it is broken and
+// the market refuses commands anyway.
+func (m *Market) void() {
+	if m.begin(Command{Type: VoidCommand}) == nil {
+		m.end()
+	}
+}
+
+// crosses tells if an order of kind with price can execute at the other price
+func crosses(kind Kind, price, other Decimal) bool {
+	if kind == Buy {
+		return price.GreaterThanOrEqual(other)
+	}
+
+	return price.LessThanOrEqual(other)
+}
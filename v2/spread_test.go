@@ -0,0 +1,100 @@
+package market
+
+import (
+	"testing"
+)
+
+func TestSpread(t *testing.T) {
+	front, back := NewMarket(), NewMarket()
+	spread := NewSpread(front, back)
+
+	if _, _, _, err := front.ProcessSellOrder("front-sell", NewDecimalValue(5), NewDecimalValue(105)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := back.ProcessBuyOrder("back-buy", NewDecimalValue(3), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	price, volume, ok := spread.Implied(Buy)
+	if !ok || !price.Equal(NewDecimalValue(5)) || !volume.Equal(NewDecimalValue(3)) {
+		t.Fatal("invalid implied ask", price, volume)
+	}
+
+	if _, _, ok := spread.Implied(Sell); ok {
+		t.Fatal("there should be no implied bid")
+	}
+
+	// a resting spread sell at 6 is worse than the implied ask at 5
+	if _, _, err := spread.ProcessSellOrder("spread-sell", NewDecimalValue(2), NewDecimalValue(6)); err != nil {
+		t.Fatal(err)
+	}
+
+	fills, resting, err := spread.ProcessBuyOrder("spread-buy", NewDecimalValue(6), NewDecimalValue(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fills) != 2 || !fills[0].Implied || !fills[0].Volume.Equal(NewDecimalValue(3)) || len(fills[0].Legs) != 2 ||
+		!fills[0].FrontPrice.Equal(NewDecimalValue(105)) || !fills[0].BackPrice.Equal(NewDecimalValue(100)) {
+		t.Fatal("implied liquidity should execute first", fills)
+	}
+
+	if fills[1].Implied || fills[1].OrderID != "spread-sell" || !fills[1].Volume.Equal(NewDecimalValue(2)) || !fills[1].Price.Equal(NewDecimalValue(6)) {
+		t.Fatal("spread order should execute next", fills)
+	}
+
+	if resting == nil || !resting.Volume.Equal(NewDecimalValue(1)) || spread.Order("spread-buy") == nil {
+		t.Fatal("volume left should rest in the spread book")
+	}
+
+	if !front.Order("front-sell").Volume.Equal(NewDecimalValue(2)) || back.Order("back-buy") != nil {
+		t.Fatal("both legs should have executed")
+	}
+
+	// no implied liquidity and the spread book is on the same side : nothing happens
+	fills, _, err = spread.ProcessBuyOrder("spread-buy-2", NewDecimalValue(1), NewDecimalValue(-2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fills) != 0 || spread.Order("spread-buy-2") == nil {
+		t.Fatal("negative spread prices should rest")
+	}
+
+	if _, _, err := spread.ProcessBuyOrder("spread-buy", NewDecimalValue(1), NewDecimalValue(1)); err == nil {
+		t.Fatal("should not be possible to add an existing order")
+	}
+}
+
+func TestSpreadImpliedDisplayed(t *testing.T) {
+	front, back := NewMarket(), NewMarket()
+	spread := NewSpread(front, back)
+
+	for _, order := range []*Order{
+		{ID: "front-hidden", Kind: Sell, Volume: NewDecimalValue(4), Price: NewDecimalValue(101), Hidden: true},
+		{ID: "front-sell", Kind: Sell, Volume: NewDecimalValue(5), Price: NewDecimalValue(105)},
+	} {
+		if _, _, _, err := front.ProcessOrder(order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, _, err := back.ProcessBuyOrder("back-buy", NewDecimalValue(3), NewDecimalValue(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the hidden level doesn't make the implied price, though the front leg executes against it first
+	price, volume, ok := spread.Implied(Buy)
+	if !ok || !price.Equal(NewDecimalValue(5)) || !volume.Equal(NewDecimalValue(3)) {
+		t.Fatal("invalid implied ask", price, volume)
+	}
+
+	fills, _, err := spread.ProcessBuyOrder("spread-buy", NewDecimalValue(3), NewDecimalValue(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fills) != 1 || !fills[0].Implied || !fills[0].Volume.Equal(NewDecimalValue(3)) {
+		t.Fatal("implied liquidity should execute", fills)
+	}
+	if !front.Order("front-hidden").Volume.Equal(NewDecimalValue(1)) || !front.Order("front-sell").Volume.Equal(NewDecimalValue(5)) {
+		t.Fatal("front leg should execute against the better hidden order")
+	}
+}
@@ -0,0 +1,163 @@
+package market
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Stats are the rolling statistics of a market over Window, as in a 24h ticker. They are exact to the statistics
+// resolution : trades of the bucket at the start of the window count until the whole bucket is out of it.
+type Stats struct {
+	Window             time.Duration
+	Open               Decimal // first price of the window
+	High               Decimal
+	Low                Decimal
+	Last               Decimal
+	Volume             Decimal
+	QuoteVolume        Decimal // sum of price * volume
+	PriceChange        Decimal // Last - Open
+	PriceChangePercent Decimal
+	VWAP               Decimal
+	Trades             int
+}
+
+// statsBucket summarizes the trades of one resolution interval
+type statsBucket struct {
+	start       time.Time
+	open        Decimal
+	high        Decimal
+	low         Decimal
+	last        Decimal
+	volume      Decimal
+	quoteVolume Decimal
+	trades      int
+}
+
+// Statistics tracks the rolling statistics of a market from its trades. Memory is bounded : trades are summed into a
+// ring of time buckets, one per resolution interval of the window, which are reused as the window moves.
+// Snapshots are safe from any goroutine.
+type Statistics struct {
+	mu         sync.Mutex
+	window     time.Duration
+	resolution time.Duration
+	buckets    []statsBucket
+}
+
+// NewStatistics tracks market over window, by buckets of resolution, such as 24 hours by minute
+func NewStatistics(market *Market, window, resolution time.Duration) (*Statistics, error) {
+	if resolution <= 0 || window < resolution || window%resolution != 0 {
+		return nil, errors.New("window must be a multiple of resolution")
+	}
+
+	result := &Statistics{
+		window:     window,
+		resolution: resolution,
+		buckets:    make([]statsBucket, window/resolution),
+	}
+
+	market.listen(result)
+	return result, nil
+}
+
+// bucket returns the bucket of the interval starting at start, in the ring
+func (s *Statistics) bucket(start time.Time) *statsBucket {
+	index := (start.UnixNano() / int64(s.resolution)) % int64(len(s.buckets))
+	if index < 0 {
+		index += int64(len(s.buckets))
+	}
+	return &s.buckets[index]
+}
+
+func (s *Statistics) OnEvent(event Event) {
+	if !event.MakerTrade() {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trade := event.Trade
+	start := trade.Time.Truncate(s.resolution)
+	bucket := s.bucket(start)
+
+	// the bucket already holds a later interval, the trade is too old for the window
+	if bucket.start.After(start) {
+		return
+	}
+
+	if bucket.trades == 0 || !bucket.start.Equal(start) {
+		*bucket = statsBucket{
+			start:       start,
+			open:        trade.Price,
+			high:        trade.Price,
+			low:         trade.Price,
+			volume:      NewZeroDecimal(),
+			quoteVolume: NewZeroDecimal(),
+		}
+	}
+
+	if trade.Price.GreaterThan(bucket.high) {
+		bucket.high = trade.Price
+	}
+	if trade.Price.LessThan(bucket.low) {
+		bucket.low = trade.Price
+	}
+
+	bucket.last = trade.Price
+	bucket.volume = bucket.volume.Add(trade.Volume)
+	bucket.quoteVolume = bucket.quoteVolume.Add(trade.Price.Mul(trade.Volume))
+	bucket.trades++
+}
+
+// Snapshot returns the statistics of the window ending at now
+func (s *Statistics) Snapshot(now time.Time) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := Stats{
+		Window:             s.window,
+		Open:               NewZeroDecimal(),
+		High:               NewZeroDecimal(),
+		Low:                NewZeroDecimal(),
+		Last:               NewZeroDecimal(),
+		Volume:             NewZeroDecimal(),
+		QuoteVolume:        NewZeroDecimal(),
+		PriceChange:        NewZeroDecimal(),
+		PriceChangePercent: NewZeroDecimal(),
+		VWAP:               NewZeroDecimal(),
+	}
+
+	// oldest bucket first
+	current := now.Truncate(s.resolution)
+	for start := current.Add(s.resolution - s.window); !start.After(current); start = start.Add(s.resolution) {
+		bucket := s.bucket(start)
+		if bucket.trades == 0 || !bucket.start.Equal(start) {
+			continue
+		}
+
+		if result.Trades == 0 {
+			result.Open, result.High, result.Low = bucket.open, bucket.high, bucket.low
+		}
+
+		if bucket.high.GreaterThan(result.High) {
+			result.High = bucket.high
+		}
+		if bucket.low.LessThan(result.Low) {
+			result.Low = bucket.low
+		}
+
+		result.Last = bucket.last
+		result.Volume = result.Volume.Add(bucket.volume)
+		result.QuoteVolume = result.QuoteVolume.Add(bucket.quoteVolume)
+		result.Trades += bucket.trades
+	}
+
+	if result.Trades > 0 {
+		result.PriceChange = result.Last.Sub(result.Open)
+		result.PriceChangePercent = result.PriceChange.Div(result.Open).Mul(NewDecimalValue(100))
+		result.VWAP = result.QuoteVolume.Div(result.Volume)
+	}
+
+	return result
+}
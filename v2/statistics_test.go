@@ -0,0 +1,64 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatistics(t *testing.T) {
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	market := NewMarket(WithClock(func() time.Time { return engineTime }))
+
+	if _, err := NewStatistics(market, 90*time.Second, time.Minute); err == nil {
+		t.Fatal("window should be a multiple of the resolution")
+	}
+
+	statistics, err := NewStatistics(market, 24*time.Hour, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trade := func(volume, price int) {
+		if _, _, _, err := market.ProcessSellOrder("sell", NewDecimalValue(int64(volume)), NewDecimalValue(int64(price))); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := market.ProcessBuyOrder("buy", NewDecimalValue(int64(volume)), NewDecimalValue(int64(price))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trade(2, 100)
+	engineTime = engineTime.Add(6 * time.Hour)
+	trade(1, 130)
+	trade(1, 90)
+	engineTime = engineTime.Add(12 * time.Hour)
+	trade(4, 110)
+
+	stats := statistics.Snapshot(engineTime)
+	if !stats.Open.Equal(NewDecimalValue(100)) || !stats.High.Equal(NewDecimalValue(130)) || !stats.Low.Equal(NewDecimalValue(90)) ||
+		!stats.Last.Equal(NewDecimalValue(110)) || !stats.Volume.Equal(NewDecimalValue(8)) || !stats.QuoteVolume.Equal(NewDecimalValue(860)) ||
+		!stats.PriceChange.Equal(NewDecimalValue(10)) || !stats.PriceChangePercent.Equal(NewDecimalValue(10)) || stats.Trades != 4 {
+		t.Fatal("invalid statistics", stats)
+	}
+	if !stats.VWAP.Equal(NewDecimalValue(860).Div(NewDecimalValue(8))) {
+		t.Fatal("invalid VWAP", stats.VWAP)
+	}
+
+	// the first trade leaves the window
+	engineTime = engineTime.Add(8 * time.Hour)
+	stats = statistics.Snapshot(engineTime)
+	if !stats.Open.Equal(NewDecimalValue(130)) || !stats.Volume.Equal(NewDecimalValue(6)) || stats.Trades != 3 {
+		t.Fatal("invalid rolled statistics", stats)
+	}
+
+	// new trades keep entering the window
+	trade(1, 120)
+	stats = statistics.Snapshot(engineTime)
+	if stats.Trades != 4 || !stats.Last.Equal(NewDecimalValue(120)) {
+		t.Fatal("invalid statistics after reuse", stats)
+	}
+
+	if stats = statistics.Snapshot(engineTime.Add(48 * time.Hour)); stats.Trades != 0 || stats.Volume.Sign() != 0 {
+		t.Fatal("statistics should be empty", stats)
+	}
+}
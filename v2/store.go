@@ -0,0 +1,250 @@
+package market
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentPrefix  = "journal-"
+	segmentSuffix  = ".log"
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".bin"
+	archiveDir     = "archive"
+)
+
+// Store keeps the journal and the snapshots of a market in a directory, so the market survives a crash.
+// The journal is split in segments named after their first command, snapshots are named after their last command.
+// Each Checkpoint starts a new segment and archives what the snapshot made useless.
+type Store struct {
+	dir     string
+	journal *Journal
+	segment string // path of the segment being written
+}
+
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, archiveDir), 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) path(prefix string, seq uint64, suffix string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", prefix, seq, suffix))
+}
+
+// list returns the files of the store named prefix, a sequence number and suffix, by sequence number
+func (s *Store) list(prefix, suffix string) ([]string, error) {
+	return listDir(s.dir, prefix, suffix)
+}
+
+func listDir(dir, prefix, suffix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		if _, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix), 10, 64); err != nil {
+			continue
+		}
+		result = append(result, filepath.Join(dir, name))
+	}
+
+	// fixed width numbers sort like strings
+	sort.Strings(result)
+	return result, nil
+}
+
+// Recover rebuilds the market from the newest valid snapshot, falling back to the archived ones, and the journal
+// commands recorded after it, then journals the market's new commands. A last record torn by a crash is truncated,
+// any other damage of the journal stops the recovery. Listeners of the options get the events of the replayed
+// commands.
+func (s *Store) Recover(options ...Option) (*Market, error) {
+	result, err := s.restoreBefore(^uint64(0), func(*MarketSnapshot) bool { return true }, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	segments, err := s.history(segmentPrefix, segmentSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, segment := range segments {
+		// archived segments only matter to an archived snapshot
+		if i+1 < len(segments) && fileSeq(segments[i+1], segmentPrefix, segmentSuffix) <= result.commands+1 {
+			continue
+		}
+
+		data, err := os.ReadFile(segment)
+		if err != nil {
+			return nil, err
+		}
+
+		valid, err := parseRecords(data, func(command Command) error {
+			if command.Seq <= result.commands {
+				return nil
+			}
+			return result.Apply(command)
+		})
+
+		if errors.Is(err, errTornRecord) && i == len(segments)-1 {
+			if err := truncate(segment, int64(valid)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("journal segment %s : %w", filepath.Base(segment), err)
+		}
+	}
+
+	result.settle()
+
+	current, err := s.list(segmentPrefix, segmentSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	s.segment = s.path(segmentPrefix, result.commands+1, segmentSuffix)
+	if len(current) > 0 {
+		s.segment = current[len(current)-1]
+	}
+
+	file, err := os.OpenFile(s.segment, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	s.journal = NewJournal(file)
+	result.journal = s.journal
+	return result, nil
+}
+
+func truncate(path string, size int64) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Checkpoint writes a durable snapshot of the market, which must be the one returned by Recover. The journal then
+// goes on in a new segment, and the older segments and snapshots are moved to the archive directory.
+func (s *Store) Checkpoint(market *Market) error {
+	if s.journal == nil || market.journal != s.journal {
+		return errors.New("market is not journaled by the store")
+	}
+
+	snapshot := market.Snapshot()
+	data, err := snapshot.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	path := s.path(snapshotPrefix, snapshot.Commands, snapshotSuffix)
+	if err := writeDurable(path, data); err != nil {
+		return err
+	}
+
+	if next := s.path(segmentPrefix, snapshot.Commands+1, segmentSuffix); next != s.segment {
+		file, err := os.OpenFile(next, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+
+		if err := s.journal.rotate(file); err != nil {
+			return err
+		}
+		s.segment = next
+	}
+
+	segments, err := s.list(segmentPrefix, segmentSuffix)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := s.list(snapshotPrefix, snapshotSuffix)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range append(segments, snapshots...) {
+		if old == s.segment || old == path {
+			continue
+		}
+
+		if err := os.Rename(old, filepath.Join(s.dir, archiveDir, filepath.Base(old))); err != nil {
+			return err
+		}
+	}
+
+	return syncDir(s.dir)
+}
+
+// writeDurable writes data to path through a synced temporary file, so path is either complete or missing
+func writeDurable(path string, data []byte) error {
+	temporary := path + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temporary, path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
+
+// Close closes the journal segment being written
+func (s *Store) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+
+	return s.journal.Close()
+}
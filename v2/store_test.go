@@ -0,0 +1,195 @@
+package market
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	engineTime := time.Date(2022, 11, 1, 10, 0, 0, 0, time.UTC)
+	options := []Option{WithClock(func() time.Time { return engineTime }), WithPriorityShare(decimalFromParts(5, -1))}
+
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	market, err := store.Recover(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := market.ProcessSellOrder("sell-0", NewDecimalValue(1), NewDecimalValue(120)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Checkpoint(market); err != nil {
+		t.Fatal(err)
+	}
+	runCommands(t, market)
+
+	// the process dies : recovery goes from the snapshot and the journal tail
+	expected, err := market.Snapshot().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var replayed int
+	store, err = OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	market, err = store.Recover(append(options, WithListener(ListenerFunc(func(Event) { replayed++ })))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := market.Snapshot().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, recovered) {
+		t.Fatal("recovered market differs")
+	}
+	if replayed == 0 {
+		t.Fatal("journal tail should be replayed")
+	}
+
+	// checkpoint archives the journal and the snapshot it made useless
+	if err := store.Checkpoint(market); err != nil {
+		t.Fatal(err)
+	}
+	archived, err := os.ReadDir(filepath.Join(dir, archiveDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 3 {
+		t.Fatal("invalid archived files count", len(archived))
+	}
+
+	market.CancelOrder("sell-0")
+	if _, _, _, err := market.ProcessBuyOrder("buy-after", NewDecimalValue(1), NewDecimalValue(90)); err != nil {
+		t.Fatal(err)
+	}
+	expected, err = market.Snapshot().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash tears the last record : only half of a copy of the first one reaches the disk
+	segments, err := store.list(segmentPrefix, segmentSuffix)
+	if err != nil || len(segments) != 1 {
+		t.Fatal("invalid segments", segments, err)
+	}
+	segment := segments[0]
+	valid, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := valid[:recordHeader+int(binary.BigEndian.Uint32(valid))/2]
+	if err := os.WriteFile(segment, append(append([]byte(nil), valid...), torn...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	market, err = store.Recover(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered, _ = market.Snapshot().MarshalBinary(); !bytes.Equal(expected, recovered) {
+		t.Fatal("market recovered from a torn journal differs")
+	}
+	if info, err := os.Stat(segment); err != nil || info.Size() != int64(len(valid)) {
+		t.Fatal("torn record should be truncated")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// corruption in the middle of the journal stops the recovery
+	corrupted := append([]byte(nil), valid...)
+	corrupted[recordHeader+2] ^= 0xff
+	if err := os.WriteFile(segment, corrupted, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Recover(options...); err == nil {
+		t.Fatal("corrupted journal should not be recovered")
+	}
+
+	// so does a damaged length, which would otherwise pass for a torn record and lose the ones after it
+	damaged := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(damaged, uint32(len(valid)))
+	if err := os.WriteFile(segment, damaged, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Recover(options...); err == nil {
+		t.Fatal("journal with a damaged record length should not be recovered")
+	}
+	if info, err := os.Stat(segment); err != nil || info.Size() != int64(len(damaged)) {
+		t.Fatal("journal with a damaged record length should not be truncated")
+	}
+}
+
+func TestStoreRecoveryArchivedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	market, err := store.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second checkpoint archives the first snapshot and the journal after it
+	for i, orderID := range []string{"sell-1", "sell-2", "sell-3"} {
+		if _, _, _, err := market.ProcessSellOrder(orderID, NewDecimalValue(1), NewDecimalValue(int64(101+i))); err != nil {
+			t.Fatal(err)
+		}
+		if i < 2 {
+			if err := store.Checkpoint(market); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	checksum := market.Checksum()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := store.list(snapshotPrefix, snapshotSuffix)
+	if err != nil || len(snapshots) != 1 {
+		t.Fatal("invalid snapshots", snapshots, err)
+	}
+	if err := os.WriteFile(snapshots[0], []byte("damaged"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	market, err = store.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if market.Commands() != 3 || market.Checksum() != checksum {
+		t.Fatal("market should be recovered from the archived snapshot", market.Commands())
+	}
+}
@@ -0,0 +1,161 @@
+package market
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// BBO is the top of the book of a market, along with its last trade and the volume traded in the session.
+// Prices and volumes of a missing side are zero, as are Spread and Mid unless both sides have displayed orders.
+// Seq is the market event sequence number of the last change.
+type BBO struct {
+	Seq           uint64
+	Time          time.Time
+	BidPrice      Decimal
+	BidVolume     Decimal
+	AskPrice      Decimal
+	AskVolume     Decimal
+	Spread        Decimal
+	Mid           Decimal
+	LastPrice     Decimal
+	LastVolume    Decimal
+	SessionVolume Decimal
+}
+
+// same tells if both records hold the same quotes and trades, whatever their sequence and time
+func (b *BBO) same(other *BBO) bool {
+	pairs := [][2]Decimal{
+		{b.BidPrice, other.BidPrice}, {b.BidVolume, other.BidVolume},
+		{b.AskPrice, other.AskPrice}, {b.AskVolume, other.AskVolume},
+		{b.LastPrice, other.LastPrice}, {b.LastVolume, other.LastVolume},
+		{b.SessionVolume, other.SessionVolume},
+	}
+
+	for _, pair := range pairs {
+		if !pair[0].Equal(pair[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Ticker maintains the BBO of a market as it changes. The record is replaced after every command that changes it, so
+// reading it is O(1) and safe from any goroutine.
+type Ticker struct {
+	market  *Market
+	current atomic.Pointer[BBO]
+
+	// only used from the market goroutine
+	lastPrice     Decimal
+	lastVolume    Decimal
+	sessionVolume Decimal
+}
+
+func NewTicker(market *Market) *Ticker {
+	result := &Ticker{
+		market:        market,
+		lastPrice:     NewZeroDecimal(),
+		lastVolume:    NewZeroDecimal(),
+		sessionVolume: NewZeroDecimal(),
+	}
+
+	result.current.Store(result.build())
+	market.listen(result)
+	market.watch(result.update)
+	return result
+}
+
+// BBO returns the latest record
+func (t *Ticker) BBO() BBO {
+	return *t.current.Load()
+}
+
+// ResetSession starts a new trading session, with no volume traded
+func (t *Ticker) ResetSession() {
+	t.sessionVolume = NewZeroDecimal()
+	t.update()
+}
+
+func (t *Ticker) OnEvent(event Event) {
+	if !event.MakerTrade() {
+		return
+	}
+
+	t.lastPrice, t.lastVolume = event.Trade.Price, event.Trade.Volume
+	t.sessionVolume = t.sessionVolume.Add(event.Trade.Volume)
+}
+
+// update replaces the record if the command changed it
+func (t *Ticker) update() {
+	next := t.build()
+	if next.same(t.current.Load()) {
+		return
+	}
+
+	t.current.Store(next)
+}
+
+func (t *Ticker) build() *BBO {
+	result := &BBO{
+		Seq:           t.market.Seq(),
+		Time:          t.market.now(),
+		BidPrice:      NewZeroDecimal(),
+		BidVolume:     NewZeroDecimal(),
+		AskPrice:      NewZeroDecimal(),
+		AskVolume:     NewZeroDecimal(),
+		Spread:        NewZeroDecimal(),
+		Mid:           NewZeroDecimal(),
+		LastPrice:     t.lastPrice,
+		LastVolume:    t.lastVolume,
+		SessionVolume: t.sessionVolume,
+	}
+
+	// levels holding only hidden orders are not part of the top of the book
+	var bid, ask *OrderQueue
+	t.market.walk(Buy, func(level *OrderQueue) bool {
+		bid = level
+		result.BidPrice, result.BidVolume = level.Price, level.Volume
+		return false
+	})
+
+	t.market.walk(Sell, func(level *OrderQueue) bool {
+		ask = level
+		result.AskPrice, result.AskVolume = level.Price, level.Volume
+		return false
+	})
+
+	if bid != nil && ask != nil {
+		result.Spread = ask.Price.Sub(bid.Price)
+		result.Mid = bid.Price.Add(ask.Price).Div(NewDecimalValue(2))
+	}
+
+	return result
+}
+
+// Run publishes the BBO at most once every interval and only when it changed since the last one published, until the
+// context is done
+func (t *Ticker) Run(ctx context.Context, interval time.Duration, ticks chan<- BBO) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var published *BBO
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := t.current.Load()
+			if current == published {
+				continue
+			}
+
+			select {
+			case ticks <- *current:
+				published = current
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
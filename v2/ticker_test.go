@@ -0,0 +1,80 @@
+package market
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTicker(t *testing.T) {
+	market := NewMarket()
+	ticker := NewTicker(market)
+
+	if bbo := ticker.BBO(); bbo.BidPrice.Sign() != 0 || bbo.AskPrice.Sign() != 0 || bbo.Spread.Sign() != 0 {
+		t.Fatal("empty market should have an empty BBO", bbo)
+	}
+
+	if _, _, _, err := market.ProcessBuyOrder("buy-1", NewDecimalValue(2), NewDecimalValue(99)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessSellOrder("sell-1", NewDecimalValue(3), NewDecimalValue(101)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := market.ProcessOrder(&Order{ID: "buy-hidden", Kind: Buy, Volume: NewDecimalValue(5), Price: NewDecimalValue(100), Hidden: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	bbo := ticker.BBO()
+	if !bbo.BidPrice.Equal(NewDecimalValue(99)) || !bbo.BidVolume.Equal(NewDecimalValue(2)) || !bbo.AskPrice.Equal(NewDecimalValue(101)) ||
+		!bbo.AskVolume.Equal(NewDecimalValue(3)) || !bbo.Spread.Equal(NewDecimalValue(2)) || !bbo.Mid.Equal(NewDecimalValue(100)) {
+		t.Fatal("invalid BBO, hidden order should not show", bbo)
+	}
+
+	// the ticker publishes the latest record, not every change
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ticks := make(chan BBO)
+	go ticker.Run(ctx, time.Millisecond, ticks)
+
+	tick := <-ticks
+	if tick.Seq != bbo.Seq {
+		t.Fatal("invalid published BBO", tick.Seq, bbo.Seq)
+	}
+
+	// trades against the hidden order, then the best bid
+	if _, _, _, err := market.ProcessSellOrder("sell-2", NewDecimalValue(6), NewDecimalValue(99)); err != nil {
+		t.Fatal(err)
+	}
+
+	bbo = ticker.BBO()
+	if !bbo.LastPrice.Equal(NewDecimalValue(99)) || !bbo.LastVolume.Equal(NewDecimalValue(1)) || !bbo.SessionVolume.Equal(NewDecimalValue(6)) {
+		t.Fatal("invalid last trade", bbo)
+	}
+	if !bbo.BidVolume.Equal(NewDecimalValue(1)) || bbo.Seq != market.Seq() {
+		t.Fatal("invalid best bid", bbo)
+	}
+
+	tick = <-ticks
+	if !tick.SessionVolume.Equal(NewDecimalValue(6)) {
+		t.Fatal("invalid published BBO", tick)
+	}
+
+	// a command changing nothing on top of the book keeps the record
+	if _, _, _, err := market.ProcessSellOrder("sell-3", NewDecimalValue(1), NewDecimalValue(120)); err != nil {
+		t.Fatal(err)
+	}
+	if ticker.BBO().Seq != bbo.Seq {
+		t.Fatal("BBO should not change")
+	}
+
+	select {
+	case tick = <-ticks:
+		t.Fatal("unchanged BBO should not be published", tick)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	ticker.ResetSession()
+	if bbo = ticker.BBO(); bbo.SessionVolume.Sign() != 0 || !bbo.LastPrice.Equal(NewDecimalValue(99)) {
+		t.Fatal("invalid new session", bbo)
+	}
+}
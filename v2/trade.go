@@ -0,0 +1,30 @@
+package market
+
+import (
+	"time"
+)
+
+// Trade is one match between a resting (maker) order and an incoming (taker) order, at the maker's price
+type Trade struct {
+	Time         time.Time
+	ID           uint64
+	MakerOrderID string
+	TakerOrderID string
+	Price        Decimal
+	Volume       Decimal
+	Aggressor    Kind // side of the taker
+}
+
+// trade records a match of volume between a resting maker order and the taker
+func (m *Market) trade(maker, taker *Order, volume Decimal) *Trade {
+	m.lastTradeID++
+	return &Trade{
+		Time:         m.now(),
+		ID:           m.lastTradeID,
+		MakerOrderID: maker.ID,
+		TakerOrderID: taker.ID,
+		Price:        maker.Price,
+		Volume:       volume,
+		Aggressor:    taker.Kind,
+	}
+}
@@ -0,0 +1,53 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrades(t *testing.T) {
+	market := NewMarket()
+	createProcesses(market, NewDecimalValue(2), "")
+
+	trades, err := market.PlaceOrder(NewBuy("buy-order", NewDecimalValue(3), NewDecimalValue(115), time.Time{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trades) != 2 {
+		t.Fatal("invalid trades count", len(trades))
+	}
+
+	expected := []Trade{
+		{ID: 1, MakerOrderID: "sell-100", TakerOrderID: "buy-order", Price: NewDecimalValue(100), Volume: NewDecimalValue(2), Aggressor: Buy},
+		{ID: 2, MakerOrderID: "sell-110", TakerOrderID: "buy-order", Price: NewDecimalValue(110), Volume: NewDecimalValue(1), Aggressor: Buy},
+	}
+	for i, trade := range trades {
+		if trade.ID != expected[i].ID || trade.MakerOrderID != expected[i].MakerOrderID || trade.TakerOrderID != expected[i].TakerOrderID ||
+			!trade.Price.Equal(expected[i].Price) || !trade.Volume.Equal(expected[i].Volume) || trade.Aggressor != expected[i].Aggressor {
+			t.Fatalf("invalid trade %d : %+v", i, trade)
+		}
+	}
+
+	if _, err := market.PlaceOrder(NewBuy("buy-50", NewDecimalValue(3), NewDecimalValue(115), time.Time{})); err == nil {
+		t.Fatal("should not be possible to place an existing order")
+	}
+
+	trades, err = market.PlaceOrder(NewSell("sell-order", NewDecimalValue(1), NewDecimalValue(100), time.Time{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trades) != 0 || market.Order("sell-order") == nil {
+		t.Fatal("order not crossing should rest")
+	}
+
+	trades, err = market.PlaceOrder(NewSell("sell-order-2", NewDecimalValue(1), NewDecimalValue(90), time.Time{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trades) != 1 || trades[0].ID != 3 || trades[0].MakerOrderID != "buy-90" || trades[0].Aggressor != Sell {
+		t.Fatal("invalid sell trade", trades)
+	}
+}